@@ -0,0 +1,90 @@
+package zstack
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/zigbee"
+)
+
+var ErrAdapterNotCoordinator = errors.New("adapter is not configured as a coordinator")
+var ErrAdapterHasNoChannel = errors.New("adapter has no channel configured")
+
+func (z *ZStack) Adopt(pctx context.Context) (zigbee.NetworkConfiguration, error) {
+	ctx, segmentEnd := z.logger.Segment(pctx, "Adapter Adopt.")
+	defer segmentEnd()
+
+	if err := z.enterResetting(); err != nil {
+		return zigbee.NetworkConfiguration{}, err
+	}
+
+	z.logger.LogInfo(ctx, "Restarting adapter.")
+	version, err := z.waitForAdapterReset(ctx)
+	if err != nil {
+		return zigbee.NetworkConfiguration{}, err
+	}
+
+	z.adapterVersion = version
+	z.initialiseScheduler(version)
+	z.setState(Configuring)
+
+	z.logger.LogInfo(ctx, "Reading existing network configuration.")
+	nc, err := z.readAdapterNetworkConfig(ctx)
+	if err != nil {
+		return zigbee.NetworkConfiguration{}, err
+	}
+
+	z.NetworkProperties.PANID = nc.PANID
+	z.NetworkProperties.ExtendedPANID = nc.ExtendedPANID
+	z.NetworkProperties.NetworkKey = nc.NetworkKey
+	z.NetworkProperties.Channel = nc.Channel
+
+	if err := z.startNetwork(ctx, version); err != nil {
+		return zigbee.NetworkConfiguration{}, err
+	}
+
+	return nc, nil
+}
+
+func (z *ZStack) readAdapterNetworkConfig(ctx context.Context) (zigbee.NetworkConfiguration, error) {
+	logicalType := ZCDNVLogicalType{}
+	panID := ZCDNVPANID{}
+	extPANID := ZCDNVExtPANID{}
+	chanList := ZCDNVChanList{}
+	activeKey := ZCDNVNwkActiveKeyInfo{}
+
+	if err := z.retryFunctions(ctx, []func(context.Context) error{
+		func(invokeCtx context.Context) error {
+			return z.readNVRAM(invokeCtx, &logicalType)
+		},
+		func(invokeCtx context.Context) error {
+			return z.readNVRAM(invokeCtx, &panID)
+		},
+		func(invokeCtx context.Context) error {
+			return z.readNVRAM(invokeCtx, &extPANID)
+		},
+		func(invokeCtx context.Context) error {
+			return z.readNVRAM(invokeCtx, &chanList)
+		},
+		func(invokeCtx context.Context) error {
+			return z.readNVRAM(invokeCtx, &activeKey)
+		},
+	}); err != nil {
+		return zigbee.NetworkConfiguration{}, err
+	}
+
+	if logicalType.LogicalType != zigbee.Coordinator {
+		return zigbee.NetworkConfiguration{}, ErrAdapterNotCoordinator
+	}
+
+	channel := bitsToChannel(chanList.Channels)
+	if channel == 0 {
+		return zigbee.NetworkConfiguration{}, ErrAdapterHasNoChannel
+	}
+
+	return zigbee.NetworkConfiguration{
+		PANID:         panID.PANID,
+		ExtendedPANID: extPANID.ExtendedPANID,
+		NetworkKey:    activeKey.Key,
+		Channel:       channel,
+	}, nil
+}
@@ -0,0 +1,135 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Adopt(t *testing.T) {
+	t.Run("an adapter with an existing network is started without writing to nvram", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		resetResponse, _ := bytecodec.Marshal(SysResetInd{
+			Reason:  External,
+			Version: Version{},
+		})
+
+		unpiMock.On(AREQ, SYS, SysResetReqID).Return(Frame{
+			MessageType: AREQ,
+			Subsystem:   SYS,
+			CommandID:   SysResetIndID,
+			Payload:     resetResponse,
+		}).Times(1)
+
+		unpiMock.On(SREQ, ZDO, ZDOStartUpFromAppRequestId).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZDOStartUpFromAppRequestReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   ZDO,
+				CommandID:   ZDOStateChangeIndID,
+				Payload:     []byte{0x09},
+			})
+		}()
+
+		unpiMock.On(SREQ, UTIL, UtilGetDeviceInfoRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   UTIL,
+			CommandID:   UtilGetDeviceInfoRequestReplyID,
+			Payload:     []byte{0x00, 0x0f, 0x0e, 0x0d, 0x0c, 0x0b, 0x0a, 0x09, 0x08, 0x09, 0x08},
+		}).Times(2)
+
+		unpiMock.On(SREQ, ZDO, ZDOMgmtPermitJoinRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZDOMgmtPermitJoinRequestReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		unpiMock.On(SREQ, ZDO, ZdoMGMTLQIReqID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoMGMTLQIReqReplyID,
+			Payload:     []byte{0x00},
+		}).UnlimitedTimes()
+
+		expected := zigbee.NetworkConfiguration{
+			PANID:         zigbee.PANID(0x0102),
+			ExtendedPANID: zigbee.ExtendedPANID(0x0102030405060708),
+			NetworkKey:    [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			Channel:       20,
+		}
+
+		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
+			nvramReadFrame(ZCDNVLogicalType{LogicalType: zigbee.Coordinator}),
+			nvramReadFrame(ZCDNVPANID{PANID: expected.PANID}),
+			nvramReadFrame(ZCDNVExtPANID{ExtendedPANID: expected.ExtendedPANID}),
+			nvramReadFrame(ZCDNVChanList{Channels: channelToBits(expected.Channel)}),
+			nvramReadFrame(ZCDNVNwkActiveKeyInfo{KeySeqNum: 0, Key: expected.NetworkKey}),
+		).Times(5)
+
+		nc, err := zstack.Adopt(ctx)
+		assert.NoError(t, err)
+		unpiMock.AssertCalls(t)
+
+		assert.Equal(t, expected, nc)
+		assert.Equal(t, expected.PANID, zstack.NetworkProperties.PANID)
+		assert.Equal(t, expected.ExtendedPANID, zstack.NetworkProperties.ExtendedPANID)
+		assert.Equal(t, expected.NetworkKey, zstack.NetworkProperties.NetworkKey)
+		assert.Equal(t, expected.Channel, zstack.NetworkProperties.Channel)
+		assert.Equal(t, zigbee.IEEEAddress(0x08090a0b0c0d0e0f), zstack.NetworkProperties.IEEEAddress)
+	})
+
+	t.Run("an adapter which is not a coordinator can not be adopted", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		resetResponse, _ := bytecodec.Marshal(SysResetInd{
+			Reason:  External,
+			Version: Version{},
+		})
+
+		unpiMock.On(AREQ, SYS, SysResetReqID).Return(Frame{
+			MessageType: AREQ,
+			Subsystem:   SYS,
+			CommandID:   SysResetIndID,
+			Payload:     resetResponse,
+		}).Times(1)
+
+		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
+			nvramReadFrame(ZCDNVLogicalType{LogicalType: zigbee.EndDevice}),
+			nvramReadFrame(ZCDNVPANID{}),
+			nvramReadFrame(ZCDNVExtPANID{}),
+			nvramReadFrame(ZCDNVChanList{Channels: channelToBits(zigbee.DefaultChannel)}),
+			nvramReadFrame(ZCDNVNwkActiveKeyInfo{}),
+		).Times(5)
+
+		_, err := zstack.Adopt(ctx)
+		assert.ErrorIs(t, err, ErrAdapterNotCoordinator)
+		unpiMock.AssertCalls(t)
+	})
+}
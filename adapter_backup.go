@@ -0,0 +1,316 @@
+package zstack
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/logwrap"
+	"github.com/shimmeringbee/zigbee"
+)
+
+const RestoreFrameCounterIncrement uint32 = 2500
+
+type Backup struct {
+	Version             Version
+	IEEEAddress         zigbee.IEEEAddress
+	PANID               zigbee.PANID
+	ExtendedPANID       zigbee.ExtendedPANID
+	Channel             uint8
+	NetworkKey          zigbee.NetworkKey
+	NetworkKeySequence  uint8
+	NetworkFrameCounter uint32
+	TCLinkKeys          []ZCDNVTCLKTableStart
+	TCLinkKeySeed       zigbee.NetworkKey
+	TCLinkKeyTable      []ZCDNVTCLKDevEntry
+}
+
+func (b Backup) NetworkConfiguration() zigbee.NetworkConfiguration {
+	return zigbee.NetworkConfiguration{
+		PANID:         b.PANID,
+		ExtendedPANID: b.ExtendedPANID,
+		NetworkKey:    b.NetworkKey,
+		Channel:       b.Channel,
+	}
+}
+
+func (z *ZStack) Backup(ctx context.Context) (Backup, error) {
+	if err := z.checkReady(); err != nil {
+		return Backup{}, err
+	}
+
+	b := Backup{Version: z.adapterVersion}
+
+	extAddr := ZCDNVExtAddr{}
+	panID := ZCDNVPANID{}
+	extPANID := ZCDNVExtPANID{}
+	chanList := ZCDNVChanList{}
+	activeKey := ZCDNVNwkActiveKeyInfo{}
+
+	if err := z.retryFunctions(ctx, []func(context.Context) error{
+		func(invokeCtx context.Context) error {
+			return z.readNVRAM(invokeCtx, &extAddr)
+		},
+		func(invokeCtx context.Context) error {
+			return z.readNVRAM(invokeCtx, &panID)
+		},
+		func(invokeCtx context.Context) error {
+			return z.readNVRAM(invokeCtx, &extPANID)
+		},
+		func(invokeCtx context.Context) error {
+			return z.readNVRAM(invokeCtx, &chanList)
+		},
+		func(invokeCtx context.Context) error {
+			return z.readNVRAM(invokeCtx, &activeKey)
+		},
+	}); err != nil {
+		return Backup{}, err
+	}
+
+	b.IEEEAddress = extAddr.IEEEAddress
+	b.PANID = panID.PANID
+	b.ExtendedPANID = extPANID.ExtendedPANID
+	b.Channel = bitsToChannel(chanList.Channels)
+	b.NetworkKey = activeKey.Key
+	b.NetworkKeySequence = activeKey.KeySeqNum
+
+	if z.adapterVersion.IsV3() {
+		if frameCounter, err := z.readNetworkFrameCounterV3(ctx, b.ExtendedPANID); err != nil {
+			return Backup{}, err
+		} else {
+			b.NetworkFrameCounter = frameCounter
+		}
+
+		seed := ZCDNVTCLKSeed{}
+		if err := z.readNVRAM(ctx, &seed); err != nil {
+			return Backup{}, err
+		}
+
+		b.TCLinkKeySeed = seed.Key
+
+		if tcLinkKeyTable, err := z.readTCLinkKeyTableV3(ctx); err != nil {
+			return Backup{}, err
+		} else {
+			b.TCLinkKeyTable = tcLinkKeyTable
+		}
+	} else {
+		nwkKey := ZCDNVNwkKey{}
+		if err := z.readNVRAM(ctx, &nwkKey); err != nil {
+			return Backup{}, err
+		}
+
+		b.NetworkFrameCounter = nwkKey.FrameCounter
+
+		if tcLinkKeys, err := z.readTCLinkKeyTable(ctx); err != nil {
+			return Backup{}, err
+		} else {
+			b.TCLinkKeys = tcLinkKeys
+		}
+	}
+
+	return b, nil
+}
+
+func (z *ZStack) readNetworkFrameCounterV3(ctx context.Context, extendedPANID zigbee.ExtendedPANID) (uint32, error) {
+	var genericFrameCounter uint32
+
+	for id := ZCDNVNwkSecMaterialTableStartID; id <= ZCDNVNwkSecMaterialTableEndID; id++ {
+		material := ZCDNVNwkSecMaterial{}
+
+		if err := z.readNVRAMByID(ctx, id, &material); err != nil {
+			if errors.Is(err, NVRAMUnsuccessful) {
+				break
+			}
+
+			return 0, err
+		}
+
+		switch material.ExtendedPANID {
+		case extendedPANID:
+			return material.FrameCounter, nil
+		case zigbee.ExtendedPANID(0xffffffffffffffff):
+			genericFrameCounter = material.FrameCounter
+		}
+	}
+
+	return genericFrameCounter, nil
+}
+
+func (z *ZStack) readTCLinkKeyTable(ctx context.Context) ([]ZCDNVTCLKTableStart, error) {
+	var entries []ZCDNVTCLKTableStart
+
+	for id := ZCDNVTCLKTableStartID; id <= ZCDNVTCLKTableEndID; id++ {
+		entry := ZCDNVTCLKTableStart{}
+
+		if err := z.readNVRAMByID(ctx, id, &entry); err != nil {
+			if errors.Is(err, NVRAMUnsuccessful) {
+				break
+			}
+
+			return nil, err
+		}
+
+		if entry.Address == zigbee.EmptyIEEEAddress && entry.NetworkKey == (zigbee.NetworkKey{}) {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (z *ZStack) readTCLinkKeyTableV3(ctx context.Context) ([]ZCDNVTCLKDevEntry, error) {
+	var entries []ZCDNVTCLKDevEntry
+
+	for i := uint16(0); i <= ZCDNVTCLKTableEndID-ZCDNVTCLKTableStartV30ID; i++ {
+		entry := ZCDNVTCLKDevEntry{}
+
+		var err error
+		if z.adapterVersion.IsV3x0() {
+			err = z.readExtendedNVRAM(ctx, NVSysIDZStack, ZCDNVExTCLKTableID, i, &entry)
+		} else {
+			err = z.readNVRAMByID(ctx, ZCDNVTCLKTableStartV30ID+i, &entry)
+		}
+
+		if err != nil {
+			if errors.Is(err, NVRAMUnsuccessful) {
+				break
+			}
+
+			return nil, err
+		}
+
+		if entry.Address == zigbee.EmptyIEEEAddress {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (z *ZStack) Restore(ctx context.Context, b Backup) error {
+	ctx, segmentEnd := z.logger.Segment(ctx, "Adapter Restore.")
+	defer segmentEnd()
+
+	if err := z.enterResetting(); err != nil {
+		return err
+	}
+
+	z.logger.LogInfo(ctx, "Restarting adapter.")
+	version, err := z.waitForAdapterReset(ctx)
+	if err != nil {
+		return err
+	}
+
+	z.adapterVersion = version
+	z.setState(Configuring)
+
+	z.NetworkProperties.PANID = b.PANID
+	z.NetworkProperties.ExtendedPANID = b.ExtendedPANID
+	z.NetworkProperties.NetworkKey = b.NetworkKey
+	z.NetworkProperties.Channel = b.Channel
+
+	z.logger.LogInfo(ctx, "Resetting adapter.")
+	if err := z.wipeAdapter(ctx); err != nil {
+		return err
+	}
+
+	z.logger.LogInfo(ctx, "Setting adapter to coordinator.")
+	if err := z.makeCoordinator(ctx); err != nil {
+		return err
+	}
+
+	z.logger.LogInfo(ctx, "Restoring adapter IEEE address.")
+	if err := z.retryFunctions(ctx, []func(context.Context) error{
+		func(invokeCtx context.Context) error {
+			return z.writeNVRAM(invokeCtx, ZCDNVExtAddr{IEEEAddress: b.IEEEAddress})
+		},
+	}); err != nil {
+		return err
+	}
+
+	z.logger.LogInfo(ctx, "Configuring adapter.")
+	if err := z.configureNetwork(ctx, version); err != nil {
+		return err
+	}
+
+	z.logger.LogInfo(ctx, "Forming network.")
+	if err := z.startZigbeeStack(ctx, version); err != nil {
+		return err
+	}
+
+	z.logger.LogInfo(ctx, "Restoring network key material.")
+	if err := z.restoreKeyMaterial(ctx, version, b); err != nil {
+		return err
+	}
+
+	z.logger.LogInfo(ctx, "Restarting adapter.")
+	if _, err := z.waitForAdapterReset(ctx); err != nil {
+		return err
+	}
+
+	z.setState(Uninitialised)
+	return nil
+}
+
+func (z *ZStack) restoreKeyMaterial(ctx context.Context, version Version, b Backup) error {
+	frameCounter := b.NetworkFrameCounter + RestoreFrameCounterIncrement
+
+	steps := []func(context.Context) error{
+		func(invokeCtx context.Context) error {
+			return z.writeNVRAM(invokeCtx, ZCDNVNwkActiveKeyInfo{KeySeqNum: b.NetworkKeySequence, Key: b.NetworkKey})
+		},
+	}
+
+	if version.IsV3() {
+		steps = append(steps, func(invokeCtx context.Context) error {
+			return z.writeNVRAM(invokeCtx, ZCDNVNwkSecMaterial{FrameCounter: frameCounter, ExtendedPANID: b.ExtendedPANID})
+		})
+
+		/* Without a seed in the backup, the seed generated by the adapter when forming the network is kept. */
+		if b.TCLinkKeySeed != (zigbee.NetworkKey{}) {
+			steps = append(steps, func(invokeCtx context.Context) error {
+				return z.writeNVRAM(invokeCtx, ZCDNVTCLKSeed{Key: b.TCLinkKeySeed})
+			})
+		}
+
+		z.warnUnrestorableTCLinkKeys(ctx, b)
+
+		for i, entry := range b.TCLinkKeyTable {
+			steps = append(steps, func(invokeCtx context.Context) error {
+				if version.IsV3x0() {
+					return z.writeExtendedNVRAM(invokeCtx, NVSysIDZStack, ZCDNVExTCLKTableID, uint16(i), entry)
+				}
+
+				return z.writeNVRAMByID(invokeCtx, ZCDNVTCLKTableStartV30ID+uint16(i), entry)
+			})
+		}
+	} else {
+		steps = append(steps, func(invokeCtx context.Context) error {
+			return z.writeNVRAM(invokeCtx, ZCDNVNwkKey{KeySeqNum: b.NetworkKeySequence, Key: b.NetworkKey, FrameCounter: frameCounter})
+		})
+
+		for i, entry := range b.TCLinkKeys {
+			steps = append(steps, func(invokeCtx context.Context) error {
+				return z.writeNVRAMByID(invokeCtx, ZCDNVTCLKTableStartID+uint16(i), entry)
+			})
+		}
+	}
+
+	return z.retryFunctions(ctx, steps)
+}
+
+func (z *ZStack) warnUnrestorableTCLinkKeys(ctx context.Context, b Backup) {
+	restorable := map[zigbee.IEEEAddress]bool{}
+
+	for _, entry := range b.TCLinkKeyTable {
+		restorable[entry.Address] = true
+	}
+
+	for _, entry := range b.TCLinkKeys {
+		if entry.Address != globalTCLinkKeyAddress && !restorable[entry.Address] {
+			z.logger.LogWarn(ctx, "Link key can not be derived from the TCLK seed, it will not be restored.", logwrap.Datum("IEEEAddress", entry.Address.String()))
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func nvramReadFrame(v interface{}) Frame {
+	value, _ := bytecodec.Marshal(v)
+	response, _ := bytecodec.Marshal(SysOSALNVReadReply{Status: ZSuccess, Value: value})
+	return Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysOSALNVReadReplyID, Payload: response}
+}
+
+func Test_Backup(t *testing.T) {
+	t.Run("a z-stack 1.2.X adapter backup contains network configuration, key material and tc link keys", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.state = Running
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		networkKey := zigbee.NetworkKey{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+		tcLinkKey := ZCDNVTCLKTableStart{Address: zigbee.IEEEAddress(0xffffffffffffffff), NetworkKey: zigbee.TCLinkKey}
+
+		failedRead, _ := bytecodec.Marshal(SysOSALNVReadReply{Status: ZFailure})
+
+		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
+			nvramReadFrame(ZCDNVExtAddr{IEEEAddress: zigbee.IEEEAddress(0x0102030405060708)}),
+			nvramReadFrame(ZCDNVPANID{PANID: zigbee.PANID(0x0102)}),
+			nvramReadFrame(ZCDNVExtPANID{ExtendedPANID: zigbee.ExtendedPANID(0x0807060504030201)}),
+			nvramReadFrame(ZCDNVChanList{Channels: channelToBits(20)}),
+			nvramReadFrame(ZCDNVNwkActiveKeyInfo{KeySeqNum: 2, Key: networkKey}),
+			nvramReadFrame(ZCDNVNwkKey{KeySeqNum: 2, Key: networkKey, FrameCounter: 12345}),
+			nvramReadFrame(tcLinkKey),
+			nvramReadFrame(ZCDNVTCLKTableStart{}),
+			Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysOSALNVReadReplyID, Payload: failedRead},
+		).Times(9)
+
+		backup, err := zstack.Backup(ctx)
+		assert.NoError(t, err)
+		unpiMock.AssertCalls(t)
+
+		assert.Equal(t, zigbee.IEEEAddress(0x0102030405060708), backup.IEEEAddress)
+		assert.Equal(t, zigbee.PANID(0x0102), backup.PANID)
+		assert.Equal(t, zigbee.ExtendedPANID(0x0807060504030201), backup.ExtendedPANID)
+		assert.Equal(t, uint8(20), backup.Channel)
+		assert.Equal(t, networkKey, backup.NetworkKey)
+		assert.Equal(t, uint8(2), backup.NetworkKeySequence)
+		assert.Equal(t, uint32(12345), backup.NetworkFrameCounter)
+		assert.Equal(t, []ZCDNVTCLKTableStart{tcLinkKey}, backup.TCLinkKeys)
+	})
+
+	t.Run("a z-stack 3.X.X adapter backup reads the frame counter from the matching security material", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.adapterVersion = Version{ProductID: 1}
+		zstack.state = Running
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		extPANID := zigbee.ExtendedPANID(0x0807060504030201)
+		tclkEntry := ZCDNVTCLKDevEntry{TXFrameCounter: 1, RXFrameCounter: 2, Address: zigbee.IEEEAddress(0x1122334455667788), KeyAttributes: 2, SeedShift: 3}
+
+		failedRead, _ := bytecodec.Marshal(SysOSALNVReadReply{Status: ZFailure})
+
+		nvramOn := unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
+			nvramReadFrame(ZCDNVExtAddr{IEEEAddress: zigbee.IEEEAddress(0x0102030405060708)}),
+			nvramReadFrame(ZCDNVPANID{PANID: zigbee.PANID(0x0102)}),
+			nvramReadFrame(ZCDNVExtPANID{ExtendedPANID: extPANID}),
+			nvramReadFrame(ZCDNVChanList{Channels: channelToBits(20)}),
+			nvramReadFrame(ZCDNVNwkActiveKeyInfo{}),
+			nvramReadFrame(ZCDNVNwkSecMaterial{FrameCounter: 10, ExtendedPANID: zigbee.ExtendedPANID(0xffffffffffffffff)}),
+			nvramReadFrame(ZCDNVNwkSecMaterial{FrameCounter: 54321, ExtendedPANID: extPANID}),
+			nvramReadFrame(ZCDNVTCLKSeed{Key: zigbee.TCLinkKey}),
+			nvramReadFrame(tclkEntry),
+			nvramReadFrame(ZCDNVTCLKDevEntry{}),
+			Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysOSALNVReadReplyID, Payload: failedRead},
+		).Times(11)
+
+		backup, err := zstack.Backup(ctx)
+		assert.NoError(t, err)
+		unpiMock.AssertCalls(t)
+
+		assert.Equal(t, uint32(54321), backup.NetworkFrameCounter)
+		assert.Equal(t, zigbee.TCLinkKey, backup.TCLinkKeySeed)
+		assert.Empty(t, backup.TCLinkKeys)
+		assert.Equal(t, []ZCDNVTCLKDevEntry{tclkEntry}, backup.TCLinkKeyTable)
+
+		assert.Equal(t, []byte{0x11, 0x01, 0x00}, nvramOn.CapturedCalls[8].Frame.Payload)
+	})
+
+	t.Run("a z-stack 3.X.0 adapter backup reads the tc link key table from the extended nv api", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.adapterVersion = Version{ProductID: 2}
+		zstack.state = Running
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		extPANID := zigbee.ExtendedPANID(0x0807060504030201)
+		tclkEntry := ZCDNVTCLKDevEntry{TXFrameCounter: 1, RXFrameCounter: 2, Address: zigbee.IEEEAddress(0x1122334455667788), KeyAttributes: 2, SeedShift: 3}
+
+		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
+			nvramReadFrame(ZCDNVExtAddr{IEEEAddress: zigbee.IEEEAddress(0x0102030405060708)}),
+			nvramReadFrame(ZCDNVPANID{PANID: zigbee.PANID(0x0102)}),
+			nvramReadFrame(ZCDNVExtPANID{ExtendedPANID: extPANID}),
+			nvramReadFrame(ZCDNVChanList{Channels: channelToBits(20)}),
+			nvramReadFrame(ZCDNVNwkActiveKeyInfo{}),
+			nvramReadFrame(ZCDNVNwkSecMaterial{FrameCounter: 54321, ExtendedPANID: extPANID}),
+			nvramReadFrame(ZCDNVTCLKSeed{Key: zigbee.TCLinkKey}),
+		).Times(7)
+
+		entryValue, _ := bytecodec.Marshal(tclkEntry)
+		entryRead, _ := bytecodec.Marshal(SysNVReadReply{Status: ZSuccess, Value: entryValue})
+		failedRead, _ := bytecodec.Marshal(SysNVReadReply{Status: ZFailure})
+
+		extendedOn := unpiMock.On(SREQ, SYS, SysNVReadID).Return(
+			Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysNVReadReplyID, Payload: entryRead},
+			Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysNVReadReplyID, Payload: failedRead},
+		).Times(2)
+
+		backup, err := zstack.Backup(ctx)
+		assert.NoError(t, err)
+		unpiMock.AssertCalls(t)
+
+		assert.Equal(t, []ZCDNVTCLKDevEntry{tclkEntry}, backup.TCLinkKeyTable)
+		assert.Equal(t, []byte{0x01, 0x04, 0x00, 0x01, 0x00, 0x00, 0x00, byte(len(entryValue))}, extendedOn.CapturedCalls[1].Frame.Payload)
+	})
+}
+
+func Test_Restore(t *testing.T) {
+	t.Run("a z-stack 1.2.X adapter is reformed with the backup and has its frame counter advanced", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		resetResponse, _ := bytecodec.Marshal(SysResetInd{
+			Reason:  External,
+			Version: Version{},
+		})
+
+		unpiMock.On(AREQ, SYS, SysResetReqID).Return(Frame{
+			MessageType: AREQ,
+			Subsystem:   SYS,
+			CommandID:   SysResetIndID,
+			Payload:     resetResponse,
+		}).Times(4)
+
+		nvramWriteResponse, _ := bytecodec.Marshal(SysOSALNVWriteReply{Status: ZSuccess})
+		nvramOn := unpiMock.On(SREQ, SYS, SysOSALNVWriteID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysOSALNVWriteReplyID,
+			Payload:     nvramWriteResponse,
+		}).Times(14)
+
+		unpiMock.On(SREQ, ZDO, ZDOStartUpFromAppRequestId).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZDOStartUpFromAppRequestReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   ZDO,
+				CommandID:   ZDOStateChangeIndID,
+				Payload:     []byte{0x09},
+			})
+		}()
+
+		backup := Backup{
+			IEEEAddress:         zigbee.IEEEAddress(0x0102030405060708),
+			PANID:               zigbee.PANID(0x0102),
+			ExtendedPANID:       zigbee.ExtendedPANID(0x0807060504030201),
+			Channel:             20,
+			NetworkKey:          zigbee.NetworkKey{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			NetworkKeySequence:  1,
+			NetworkFrameCounter: 1000,
+			TCLinkKeys: []ZCDNVTCLKTableStart{
+				{Address: zigbee.IEEEAddress(0x1122334455667788), NetworkKey: zigbee.TCLinkKey, TXFrameCounter: 1, RXFrameCounter: 2},
+			},
+		}
+
+		err := zstack.Restore(ctx, backup)
+		assert.NoError(t, err)
+		unpiMock.AssertCalls(t)
+
+		assert.Equal(t, backup.NetworkConfiguration(), zigbee.NetworkConfiguration{
+			PANID:         zstack.NetworkProperties.PANID,
+			ExtendedPANID: zstack.NetworkProperties.ExtendedPANID,
+			NetworkKey:    zstack.NetworkProperties.NetworkKey,
+			Channel:       zstack.NetworkProperties.Channel,
+		})
+
+		assert.Equal(t, []byte{0x01, 0x00, 0x00, 0x08, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}, nvramOn.CapturedCalls[2].Frame.Payload)
+
+		expectedNwkKey, _ := bytecodec.Marshal(ZCDNVNwkKey{KeySeqNum: 1, Key: backup.NetworkKey, FrameCounter: 1000 + RestoreFrameCounterIncrement})
+		assert.Equal(t, append([]byte{0x82, 0x00, 0x00, byte(len(expectedNwkKey))}, expectedNwkKey...), nvramOn.CapturedCalls[12].Frame.Payload)
+
+		expectedTCLK, _ := bytecodec.Marshal(backup.TCLinkKeys[0])
+		assert.Equal(t, append([]byte{0x01, 0x01, 0x00, byte(len(expectedTCLK))}, expectedTCLK...), nvramOn.CapturedCalls[13].Frame.Payload)
+	})
+}
+
+func Test_restoreKeyMaterial(t *testing.T) {
+	t.Run("a z-stack 3.X.0 adapter has its tc link key table written through the extended nv api", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		nvramWriteResponse, _ := bytecodec.Marshal(SysOSALNVWriteReply{Status: ZSuccess})
+		unpiMock.On(SREQ, SYS, SysOSALNVWriteID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysOSALNVWriteReplyID,
+			Payload:     nvramWriteResponse,
+		}).Times(3)
+
+		createResponse, _ := bytecodec.Marshal(SysNVCreateReply{Status: ZNVItemUninit})
+		unpiMock.On(SREQ, SYS, SysNVCreateID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysNVCreateReplyID,
+			Payload:     createResponse,
+		})
+
+		writeResponse, _ := bytecodec.Marshal(SysNVWriteReply{Status: ZSuccess})
+		writeOn := unpiMock.On(SREQ, SYS, SysNVWriteID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysNVWriteReplyID,
+			Payload:     writeResponse,
+		})
+
+		backup := Backup{
+			TCLinkKeySeed: zigbee.TCLinkKey,
+			TCLinkKeyTable: []ZCDNVTCLKDevEntry{
+				{TXFrameCounter: 1, RXFrameCounter: 2, Address: zigbee.IEEEAddress(0x1122334455667788), KeyAttributes: 2, SeedShift: 3},
+			},
+		}
+
+		err := zstack.restoreKeyMaterial(ctx, Version{ProductID: 2}, backup)
+		assert.NoError(t, err)
+		unpiMock.AssertCalls(t)
+
+		expectedEntry, _ := bytecodec.Marshal(backup.TCLinkKeyTable[0])
+		assert.Equal(t, append([]byte{0x01, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, byte(len(expectedEntry))}, expectedEntry...), writeOn.CapturedCalls[0].Frame.Payload)
+	})
+	t.Run("a z-stack 3.X.X adapter keeps its own tclk seed if the backup has none", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		nvramWriteResponse, _ := bytecodec.Marshal(SysOSALNVWriteReply{Status: ZSuccess})
+		nvramOn := unpiMock.On(SREQ, SYS, SysOSALNVWriteID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysOSALNVWriteReplyID,
+			Payload:     nvramWriteResponse,
+		}).Times(2)
+
+		err := zstack.restoreKeyMaterial(ctx, Version{ProductID: 1}, Backup{})
+		assert.NoError(t, err)
+		unpiMock.AssertCalls(t)
+
+		for _, call := range nvramOn.CapturedCalls {
+			write := SysOSALNVWrite{}
+			assert.NoError(t, bytecodec.Unmarshal(call.Frame.Payload, &write))
+			assert.NotEqual(t, ZCDNVTCLKSeedID, write.NVItemID)
+		}
+	})
+}
@@ -7,10 +7,15 @@ import (
 )
 
 func (z *ZStack) RegisterAdapterEndpoint(ctx context.Context, endpoint zigbee.Endpoint, appProfileId zigbee.ProfileID, appDeviceId uint16, appDeviceVersion uint8, inClusters []zigbee.ClusterID, outClusters []zigbee.ClusterID) error {
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		return fmt.Errorf("failed to acquire semaphore: %w", err)
+	if err := z.checkReady(); err != nil {
+		return err
+	}
+
+	release, err := z.scheduler.acquire(ctx, PriorityInteractive, z.NetworkProperties.NetworkAddress)
+	if err != nil {
+		return fmt.Errorf("failed to acquire request slot: %w", err)
 	}
-	defer z.sem.Release(1)
+	defer release()
 
 	request := AFRegister{
 		Endpoint:         endpoint,
@@ -22,6 +27,16 @@ func (z *ZStack) RegisterAdapterEndpoint(ctx context.Context, endpoint zigbee.En
 		AppOutClusters:   outClusters,
 	}
 
+	if err := z.registerAdapterEndpoint(ctx, request); err != nil {
+		return err
+	}
+
+	z.rememberAdapterEndpoint(request)
+
+	return nil
+}
+
+func (z *ZStack) registerAdapterEndpoint(ctx context.Context, request AFRegister) error {
 	resp := AFRegisterReply{}
 
 	if err := z.requestResponder.RequestResponse(ctx, request, &resp); err != nil {
@@ -35,6 +50,27 @@ func (z *ZStack) RegisterAdapterEndpoint(ctx context.Context, endpoint zigbee.En
 	return nil
 }
 
+func (z *ZStack) rememberAdapterEndpoint(request AFRegister) {
+	z.registeredEndpointsLock.Lock()
+	defer z.registeredEndpointsLock.Unlock()
+
+	for i, existing := range z.registeredEndpoints {
+		if existing.Endpoint == request.Endpoint {
+			z.registeredEndpoints[i] = request
+			return
+		}
+	}
+
+	z.registeredEndpoints = append(z.registeredEndpoints, request)
+}
+
+func (z *ZStack) adapterEndpoints() []AFRegister {
+	z.registeredEndpointsLock.Lock()
+	defer z.registeredEndpointsLock.Unlock()
+
+	return append([]AFRegister(nil), z.registeredEndpoints...)
+}
+
 type AFRegister struct {
 	Endpoint         zigbee.Endpoint
 	AppProfileId     zigbee.ProfileID
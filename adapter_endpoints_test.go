@@ -8,7 +8,6 @@ import (
 	unpiTest "github.com/shimmeringbee/unpi/testing"
 	"github.com/shimmeringbee/zigbee"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/sync/semaphore"
 	"testing"
 	"time"
 )
@@ -20,7 +19,8 @@ func Test_RegisterAdapterEndpoint(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		c := unpiMock.On(SREQ, AF, AFRegisterID).Return(Frame{
@@ -38,6 +38,10 @@ func Test_RegisterAdapterEndpoint(t *testing.T) {
 		frame := c.CapturedCalls[0].Frame
 
 		assert.Equal(t, []byte{0x01, 0x04, 0x01, 0x01, 0x00, 0x01, 0x00, 0x01, 0x01, 0x00, 0x01, 0x02, 0x00}, frame.Payload)
+
+		endpoints := zstack.adapterEndpoints()
+		assert.Len(t, endpoints, 1)
+		assert.Equal(t, zigbee.Endpoint(0x01), endpoints[0].Endpoint)
 	})
 
 	t.Run("returns an error if the query fails", func(t *testing.T) {
@@ -46,7 +50,8 @@ func Test_RegisterAdapterEndpoint(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		unpiMock.On(SREQ, AF, AFRegisterID).Return(Frame{
@@ -59,6 +64,7 @@ func Test_RegisterAdapterEndpoint(t *testing.T) {
 		err := zstack.RegisterAdapterEndpoint(ctx, 0x01, 0x0104, 0x0001, 0x01, []zigbee.ClusterID{0x0001}, []zigbee.ClusterID{0x0002})
 		assert.Error(t, err)
 		assert.Equal(t, ErrorZFailure, err)
+		assert.Empty(t, zstack.adapterEndpoints())
 
 		unpiMock.AssertCalls(t)
 	})
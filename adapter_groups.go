@@ -0,0 +1,97 @@
+package zstack
+
+import (
+	"context"
+	"fmt"
+	"github.com/shimmeringbee/zigbee"
+)
+
+func (z *ZStack) AddAdapterEndpointToGroup(ctx context.Context, endpoint zigbee.Endpoint, groupID zigbee.GroupID) error {
+	reply := ZdoExtAddGroupReply{}
+
+	if err := z.adapterGroupRequest(ctx, ZdoExtAddGroup{Endpoint: endpoint, GroupID: groupID}, &reply); err != nil {
+		return err
+	}
+
+	if reply.Status != ZSuccess {
+		return ZStackStatusError{Err: ErrorZFailure, Status: reply.Status}
+	}
+
+	return nil
+}
+
+func (z *ZStack) RemoveAdapterEndpointFromGroup(ctx context.Context, endpoint zigbee.Endpoint, groupID zigbee.GroupID) error {
+	reply := ZdoExtRemoveGroupReply{}
+
+	if err := z.adapterGroupRequest(ctx, ZdoExtRemoveGroup{Endpoint: endpoint, GroupID: groupID}, &reply); err != nil {
+		return err
+	}
+
+	if reply.Status != ZSuccess {
+		return ZStackStatusError{Err: ErrorZFailure, Status: reply.Status}
+	}
+
+	return nil
+}
+
+func (z *ZStack) IsAdapterEndpointInGroup(ctx context.Context, endpoint zigbee.Endpoint, groupID zigbee.GroupID) (bool, error) {
+	reply := ZdoExtFindGroupReply{}
+
+	if err := z.adapterGroupRequest(ctx, ZdoExtFindGroup{Endpoint: endpoint, GroupID: groupID}, &reply); err != nil {
+		return false, err
+	}
+
+	return reply.Status == ZSuccess, nil
+}
+
+func (z *ZStack) adapterGroupRequest(ctx context.Context, request interface{}, reply interface{}) error {
+	if err := z.checkReady(); err != nil {
+		return err
+	}
+
+	release, err := z.scheduler.acquire(ctx, PriorityInteractive, z.NetworkProperties.NetworkAddress)
+	if err != nil {
+		return fmt.Errorf("failed to acquire request slot: %w", err)
+	}
+	defer release()
+
+	return z.requestResponder.RequestResponse(ctx, request, reply)
+}
+
+type ZdoExtAddGroup struct {
+	Endpoint  zigbee.Endpoint
+	GroupID   zigbee.GroupID
+	GroupName []byte `bcsliceprefix:"8"`
+}
+
+const ZdoExtAddGroupID uint8 = 0x4b
+
+type ZdoExtAddGroupReply GenericZStackStatus
+
+const ZdoExtAddGroupReplyID uint8 = 0x4b
+
+type ZdoExtRemoveGroup struct {
+	Endpoint zigbee.Endpoint
+	GroupID  zigbee.GroupID
+}
+
+const ZdoExtRemoveGroupID uint8 = 0x47
+
+type ZdoExtRemoveGroupReply GenericZStackStatus
+
+const ZdoExtRemoveGroupReplyID uint8 = 0x47
+
+type ZdoExtFindGroup struct {
+	Endpoint zigbee.Endpoint
+	GroupID  zigbee.GroupID
+}
+
+const ZdoExtFindGroupID uint8 = 0x4a
+
+type ZdoExtFindGroupReply struct {
+	Status    ZStackStatus
+	GroupID   zigbee.GroupID
+	GroupName []byte `bcsliceprefix:"8"`
+}
+
+const ZdoExtFindGroupReplyID uint8 = 0x4a
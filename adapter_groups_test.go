@@ -0,0 +1,130 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_AdapterGroups(t *testing.T) {
+	t.Run("adds adapter endpoint to group", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		c := unpiMock.On(SREQ, ZDO, ZdoExtAddGroupID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoExtAddGroupReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		err := zstack.AddAdapterEndpointToGroup(ctx, 0x01, 0x4001)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []byte{0x01, 0x01, 0x40, 0x00}, c.CapturedCalls[0].Frame.Payload)
+	})
+
+	t.Run("returns the status if adding to group fails", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		unpiMock.On(SREQ, ZDO, ZdoExtAddGroupID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoExtAddGroupReplyID,
+			Payload:     []byte{0x10},
+		})
+
+		err := zstack.AddAdapterEndpointToGroup(ctx, 0x01, 0x4001)
+		assert.ErrorIs(t, err, ErrorZFailure)
+		assert.ErrorIs(t, err, ZMemError)
+	})
+
+	t.Run("removes adapter endpoint from group", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		c := unpiMock.On(SREQ, ZDO, ZdoExtRemoveGroupID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoExtRemoveGroupReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		err := zstack.RemoveAdapterEndpointFromGroup(ctx, 0x01, 0x4001)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []byte{0x01, 0x01, 0x40}, c.CapturedCalls[0].Frame.Payload)
+	})
+
+	t.Run("reports group membership of adapter endpoint", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		unpiMock.On(SREQ, ZDO, ZdoExtFindGroupID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoExtFindGroupReplyID,
+			Payload:     []byte{0x00, 0x01, 0x40, 0x00},
+		}, Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoExtFindGroupReplyID,
+			Payload:     []byte{0x01, 0x00, 0x00, 0x00},
+		}).Times(2)
+
+		member, err := zstack.IsAdapterEndpointInGroup(ctx, 0x01, 0x4001)
+		assert.NoError(t, err)
+		assert.True(t, member)
+
+		member, err = zstack.IsAdapterEndpointInGroup(ctx, 0x01, 0x4002)
+		assert.NoError(t, err)
+		assert.False(t, member)
+	})
+
+	t.Run("verify ZdoExtFindGroupReply marshals", func(t *testing.T) {
+		req := ZdoExtFindGroupReply{
+			Status:    ZSuccess,
+			GroupID:   0x4001,
+			GroupName: []byte{0x41},
+		}
+
+		data, err := bytecodec.Marshal(req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x00, 0x01, 0x40, 0x01, 0x41}, data)
+	})
+}
@@ -0,0 +1,126 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/logwrap"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultHealthCheckInterval         = 10 * time.Second
+	DefaultHealthCheckFailureThreshold = 3
+)
+
+type AdapterHealth struct {
+	Healthy             bool
+	Latency             time.Duration
+	ConsecutiveFailures int
+	LastChecked         time.Time
+}
+
+type AdapterUnhealthyEvent struct {
+	ConsecutiveFailures int
+	Err                 error
+}
+
+type AdapterRecoveredEvent struct {
+	Latency time.Duration
+}
+
+type adapterHealth struct {
+	lock   sync.RWMutex
+	health AdapterHealth
+}
+
+func (z *ZStack) Health() AdapterHealth {
+	z.adapterHealth.lock.RLock()
+	defer z.adapterHealth.lock.RUnlock()
+
+	return z.adapterHealth.health
+}
+
+func (z *ZStack) startHealthCheck() {
+	z.stopHealthCheck()
+
+	z.adapterHealth.lock.Lock()
+	z.adapterHealth.health = AdapterHealth{Healthy: true}
+	z.adapterHealth.lock.Unlock()
+
+	stop := make(chan struct{})
+	z.healthCheckStop = stop
+
+	z.goBackground(func() { z.healthCheck(stop) })
+}
+
+func (z *ZStack) stopHealthCheck() {
+	if z.healthCheckStop != nil {
+		close(z.healthCheckStop)
+		z.healthCheckStop = nil
+	}
+}
+
+func (z *ZStack) healthCheck(stop chan struct{}) {
+	for {
+		select {
+		case <-time.After(z.healthCheckInterval):
+			z.checkHealth()
+		case <-stop:
+			return
+		case <-z.ctx.Done():
+			return
+		}
+	}
+}
+
+func (z *ZStack) checkHealth() {
+	ctx, cancel := context.WithTimeout(z.ctx, z.config.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := z.requestResponder.RequestResponse(ctx, SysPing{}, &SysPingReply{})
+	latency := time.Since(start)
+
+	z.adapterHealth.lock.Lock()
+
+	wasHealthy := z.adapterHealth.health.Healthy
+	z.adapterHealth.health.LastChecked = start
+
+	if err != nil {
+		z.adapterHealth.health.ConsecutiveFailures++
+
+		if z.adapterHealth.health.ConsecutiveFailures >= DefaultHealthCheckFailureThreshold {
+			z.adapterHealth.health.Healthy = false
+		}
+	} else {
+		z.adapterHealth.health.ConsecutiveFailures = 0
+		z.adapterHealth.health.Latency = latency
+		z.adapterHealth.health.Healthy = true
+	}
+
+	health := z.adapterHealth.health
+	z.adapterHealth.lock.Unlock()
+
+	if err != nil {
+		z.logger.LogWarn(ctx, "Adapter failed to respond to ping.", logwrap.Err(err), logwrap.Datum("ConsecutiveFailures", health.ConsecutiveFailures))
+	}
+
+	switch {
+	case wasHealthy && !health.Healthy:
+		z.logger.LogError(ctx, "Adapter is unhealthy.", logwrap.Datum("ConsecutiveFailures", health.ConsecutiveFailures))
+		z.sendEvent(AdapterUnhealthyEvent{ConsecutiveFailures: health.ConsecutiveFailures, Err: err})
+	case !wasHealthy && health.Healthy:
+		z.logger.LogInfo(ctx, "Adapter has recovered.", logwrap.Datum("Latency", health.Latency))
+		z.sendEvent(AdapterRecoveredEvent{Latency: health.Latency})
+	}
+}
+
+type SysPing struct{}
+
+const SysPingID uint8 = 0x01
+
+type SysPingReply struct {
+	Capabilities uint16
+}
+
+const SysPingReplyID uint8 = 0x01
@@ -0,0 +1,86 @@
+package zstack
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func Test_HealthCheck(t *testing.T) {
+	t.Run("pings the adapter and records it as healthy", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		unpiMock.On(SREQ, SYS, SysPingID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysPingReplyID,
+			Payload:     []byte{0x79, 0x06},
+		})
+
+		zstack.checkHealth()
+
+		health := zstack.Health()
+		assert.True(t, health.Healthy)
+		assert.Equal(t, 0, health.ConsecutiveFailures)
+		assert.False(t, health.LastChecked.IsZero())
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("emits unhealthy after consecutive failures and recovered once a ping succeeds", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		mrr := new(MockRequestResponder)
+		defer mrr.AssertExpectations(t)
+		zstack.requestResponder = mrr
+
+		zstack.adapterHealth.health.Healthy = true
+
+		pingErr := errors.New("timeout")
+		mrr.On("RequestResponse", mock.Anything, SysPing{}, mock.Anything).Return(pingErr).Times(DefaultHealthCheckFailureThreshold)
+		mrr.On("RequestResponse", mock.Anything, SysPing{}, mock.Anything).Return(nil).Once()
+
+		for i := 0; i < DefaultHealthCheckFailureThreshold; i++ {
+			zstack.checkHealth()
+		}
+
+		assert.False(t, zstack.Health().Healthy)
+
+		event, err := zstack.ReadEvent(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, AdapterUnhealthyEvent{ConsecutiveFailures: DefaultHealthCheckFailureThreshold, Err: pingErr}, event)
+
+		zstack.checkHealth()
+
+		assert.True(t, zstack.Health().Healthy)
+
+		event, err = zstack.ReadEvent(ctx)
+		assert.NoError(t, err)
+		assert.IsType(t, AdapterRecoveredEvent{}, event)
+	})
+}
+
+func Test_SysPingStructs(t *testing.T) {
+	t.Run("SysPingReply", func(t *testing.T) {
+		s := SysPingReply{Capabilities: 0x0679}
+
+		actualBytes, err := bytecodec.Marshal(s)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x79, 0x06}, actualBytes)
+	})
+}
@@ -15,6 +15,10 @@ func (z *ZStack) AdapterNode() zigbee.Node {
 }
 
 func (z *ZStack) GetAdapterIEEEAddress(ctx context.Context) (zigbee.IEEEAddress, error) {
+	if err := z.checkReady(); err != nil {
+		return zigbee.EmptyIEEEAddress, err
+	}
+
 	data, err := z.getAddressInfo(ctx)
 	ieeeAddress := data.IEEEAddress
 
@@ -22,6 +26,10 @@ func (z *ZStack) GetAdapterIEEEAddress(ctx context.Context) (zigbee.IEEEAddress,
 }
 
 func (z *ZStack) GetAdapterNetworkAddress(ctx context.Context) (zigbee.NetworkAddress, error) {
+	if err := z.checkReady(); err != nil {
+		return zigbee.NetworkAddress(0x0), err
+	}
+
 	data, err := z.getAddressInfo(ctx)
 
 	networkAddress := data.NetworkAddress
@@ -31,12 +39,13 @@ func (z *ZStack) GetAdapterNetworkAddress(ctx context.Context) (zigbee.NetworkAd
 func (z *ZStack) getAddressInfo(ctx context.Context) (UtilGetDeviceInfoRequestReply, error) {
 	resp := UtilGetDeviceInfoRequestReply{}
 
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		return resp, fmt.Errorf("failed to acquire semaphore: %w", err)
+	release, err := z.scheduler.acquire(ctx, PriorityInteractive, z.NetworkProperties.NetworkAddress)
+	if err != nil {
+		return resp, fmt.Errorf("failed to acquire request slot: %w", err)
 	}
-	defer z.sem.Release(1)
+	defer release()
 
-	err := z.requestResponder.RequestResponse(ctx, UtilGetDeviceInfoRequest{}, &resp)
+	err = z.requestResponder.RequestResponse(ctx, UtilGetDeviceInfoRequest{}, &resp)
 	return resp, err
 }
 
@@ -8,7 +8,6 @@ import (
 	unpiTest "github.com/shimmeringbee/unpi/testing"
 	"github.com/shimmeringbee/zigbee"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/sync/semaphore"
 	"testing"
 	"time"
 )
@@ -20,7 +19,8 @@ func Test_GetAdapterIEEEAddress(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		unpiMock.On(SREQ, UTIL, UtilGetDeviceInfoRequestID).Return(Frame{
@@ -45,7 +45,8 @@ func Test_GetAdapterNetworkAddress(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		unpiMock.On(SREQ, UTIL, UtilGetDeviceInfoRequestID).Return(Frame{
@@ -7,11 +7,12 @@ import (
 	"github.com/shimmeringbee/logwrap"
 	"github.com/shimmeringbee/retry"
 	"github.com/shimmeringbee/zigbee"
-	"golang.org/x/sync/semaphore"
 	"reflect"
 )
 
 func (z *ZStack) Initialise(pctx context.Context, nc zigbee.NetworkConfiguration) error {
+	nc = z.withPersistedNetworkKey(z.withPersistedChannel(nc))
+
 	z.NetworkProperties.PANID = nc.PANID
 	z.NetworkProperties.ExtendedPANID = nc.ExtendedPANID
 	z.NetworkProperties.NetworkKey = nc.NetworkKey
@@ -20,63 +21,147 @@ func (z *ZStack) Initialise(pctx context.Context, nc zigbee.NetworkConfiguration
 	ctx, segmentEnd := z.logger.Segment(pctx, "Adapter Initialise.")
 	defer segmentEnd()
 
+	if err := z.enterResetting(); err != nil {
+		return err
+	}
+
 	z.logger.LogInfo(ctx, "Restarting adapter.")
 	version, err := z.waitForAdapterReset(ctx)
 	if err != nil {
 		return err
 	}
 
-	if version.IsV3() {
-		z.sem = semaphore.NewWeighted(16)
-	} else {
-		z.sem = semaphore.NewWeighted(2)
-	}
+	z.adapterVersion = version
+	z.initialiseScheduler(version)
 
 	z.logger.LogInfo(ctx, "Verifying existing network configuration.")
-	if valid, err := z.verifyAdapterNetworkConfig(ctx, version); err != nil {
+	verification, err := z.verifyAdapterNetworkConfig(ctx, nc)
+	if err != nil {
 		return err
-	} else if !valid {
-		z.logger.LogWarn(ctx, "Adapter network configuration is invalid, resetting adapter.")
-		if err := z.wipeAdapter(ctx); err != nil {
-			return err
-		}
+	}
 
-		z.logger.LogInfo(ctx, "Setting adapter to coordinator.")
-		if err := z.makeCoordinator(ctx); err != nil {
-			return err
+	if !verification.Valid() {
+		for _, mismatch := range verification.Mismatches {
+			z.logger.LogDebug(ctx, "Adapter network configuration item does not match.", logwrap.Datum("Item", mismatch.Item))
 		}
 
-		z.logger.LogInfo(ctx, "Configuring adapter.")
-		if err := z.configureNetwork(ctx, version); err != nil {
-			return err
-		}
+		z.logger.LogWarn(ctx, "Adapter network configuration is invalid, resetting adapter.")
 	}
 
-	z.logger.LogInfo(ctx, "Starting Zigbee stack.")
-	if err := z.startZigbeeStack(ctx, version); err != nil {
-		return err
+	z.setState(Configuring)
+
+	return z.runConfigurationSteps(ctx, z.initialiseSteps(version, verification))
+}
+
+type AdapterDiagnosis struct {
+	Version      Version
+	Verification NetworkConfigVerification
+	Actions      []string
+}
+
+func (z *ZStack) DiagnoseAdapter(pctx context.Context, nc zigbee.NetworkConfiguration) (AdapterDiagnosis, error) {
+	nc = z.withPersistedNetworkKey(z.withPersistedChannel(nc))
+
+	ctx, segmentEnd := z.logger.Segment(pctx, "Adapter Diagnose.")
+	defer segmentEnd()
+
+	if err := z.checkIdle(); err != nil {
+		return AdapterDiagnosis{}, err
 	}
 
-	z.logger.LogInfo(ctx, "Fetching adapter IEEE and Network addresses.")
-	if err := z.retrieveAdapterAddresses(ctx); err != nil {
-		return err
+	z.logger.LogInfo(ctx, "Restarting adapter.")
+	version, err := z.waitForAdapterReset(ctx)
+	if err != nil {
+		return AdapterDiagnosis{}, err
 	}
 
-	z.logger.LogInfo(ctx, "Enforcing denial of network joins.")
-	if err := z.DenyJoin(ctx); err != nil {
-		return err
+	z.logger.LogInfo(ctx, "Verifying existing network configuration.")
+	verification, err := z.verifyAdapterNetworkConfig(ctx, nc)
+	if err != nil {
+		return AdapterDiagnosis{}, err
 	}
 
-	z.startNetworkManager()
-	z.startMessageReceiver()
+	diagnosis := AdapterDiagnosis{Version: version, Verification: verification}
 
-	return nil
+	for _, step := range z.initialiseSteps(version, verification) {
+		diagnosis.Actions = append(diagnosis.Actions, step.description)
+	}
+
+	return diagnosis, nil
+}
+
+func (z *ZStack) initialiseSteps(version Version, verification NetworkConfigVerification) []configurationStep {
+	var steps []configurationStep
+
+	if !verification.Valid() {
+		steps = append(steps, z.wipeAdapterSteps()...)
+		steps = append(steps, z.makeCoordinatorSteps()...)
+		steps = append(steps, z.configureNetworkSteps(version)...)
+	}
+
+	steps = append(steps, z.startNetworkSteps(version)...)
+
+	if !verification.Valid() {
+		steps = append(steps, z.selectChannelSteps()...)
+	}
+
+	return steps
+}
+
+func (z *ZStack) initialiseScheduler(version Version) {
+	if z.config.schedulerCapacity > 0 {
+		z.scheduler.setCapacity(z.config.schedulerCapacity)
+	} else if version.IsV3() {
+		z.scheduler.setCapacity(16)
+	} else {
+		z.scheduler.setCapacity(2)
+	}
+}
+
+func (z *ZStack) startNetwork(ctx context.Context, version Version) error {
+	return z.runConfigurationSteps(ctx, z.startNetworkSteps(version))
+}
+
+func (z *ZStack) startNetworkSteps(version Version) []configurationStep {
+	return []configurationStep{
+		{
+			description: "Start Zigbee stack.",
+			noRetry:     true,
+			invoke: func(ctx context.Context) error {
+				return z.startZigbeeStack(ctx, version)
+			},
+		},
+		{
+			description: "Fetch adapter IEEE and network addresses.",
+			noRetry:     true,
+			invoke:      z.retrieveAdapterAddresses,
+		},
+		{
+			description: "Enforce denial of network joins.",
+			noRetry:     true,
+			invoke: func(ctx context.Context) error {
+				return z.sendJoin(ctx, zigbee.BroadcastRoutersCoordinators, JoiningOff, Off)
+			},
+		},
+		{
+			description: "Start network manager, message receiver, adapter monitor and health check.",
+			noRetry:     true,
+			invoke: func(ctx context.Context) error {
+				z.startNetworkManager()
+				z.startMessageReceiver()
+				z.startAdapterMonitor()
+				z.startHealthCheck()
+				z.setState(Running)
+				return nil
+			},
+		},
+	}
 }
 
 func (z *ZStack) waitForAdapterReset(ctx context.Context) (Version, error) {
 	retVersion := Version{}
 
-	err := retry.Retry(ctx, DefaultZStackTimeout, 18, func(invokeCtx context.Context) error {
+	err := retry.Retry(ctx, z.config.timeout, 18, func(invokeCtx context.Context) error {
 		version, err := z.resetAdapter(invokeCtx, Soft)
 		retVersion = version
 		return err
@@ -85,153 +170,234 @@ func (z *ZStack) waitForAdapterReset(ctx context.Context) (Version, error) {
 	return retVersion, err
 }
 
-func (z *ZStack) verifyAdapterNetworkConfig(ctx context.Context, version Version) (bool, error) {
+type NetworkConfigMismatch struct {
+	Item     string
+	Expected interface{}
+	Actual   interface{}
+}
+
+type NetworkConfigVerification struct {
+	Mismatches []NetworkConfigMismatch
+}
+
+func (v NetworkConfigVerification) Valid() bool {
+	return len(v.Mismatches) == 0
+}
+
+func (z *ZStack) verifyAdapterNetworkConfig(ctx context.Context, nc zigbee.NetworkConfiguration) (NetworkConfigVerification, error) {
 	configToVerify := []interface{}{
 		&ZCDNVLogicalType{LogicalType: zigbee.Coordinator},
-		&ZCDNVPANID{PANID: z.NetworkProperties.PANID},
-		&ZCDNVExtPANID{ExtendedPANID: z.NetworkProperties.ExtendedPANID},
-		&ZCDNVChanList{Channels: channelToBits(z.NetworkProperties.Channel)},
+		&ZCDNVPANID{PANID: nc.PANID},
+		&ZCDNVExtPANID{ExtendedPANID: nc.ExtendedPANID},
+		&ZCDNVChanList{Channels: channelToBits(nc.Channel)},
+		&ZCDNVPreCfgKeysEnable{Enabled: 1},
+		&ZCDNVPreCfgKey{NetworkKey: nc.NetworkKey},
 	}
 
+	verification := NetworkConfigVerification{}
+
 	for _, expectedConfig := range configToVerify {
 		configType := reflect.TypeOf(expectedConfig).Elem()
 		actualConfig := reflect.New(configType).Interface()
 
 		if err := z.readNVRAM(ctx, actualConfig); err != nil {
-			return false, err
+			return NetworkConfigVerification{}, err
 		}
 
 		if !reflect.DeepEqual(expectedConfig, actualConfig) {
-			return false, nil
+			verification.Mismatches = append(verification.Mismatches, NetworkConfigMismatch{
+				Item:     configType.Name(),
+				Expected: reflect.ValueOf(expectedConfig).Elem().Interface(),
+				Actual:   reflect.ValueOf(actualConfig).Elem().Interface(),
+			})
 		}
 	}
 
-	return true, nil
+	return verification, nil
+}
+
+type configurationStep struct {
+	description string
+	invoke      func(context.Context) error
+	noRetry     bool
+}
+
+func (z *ZStack) runConfigurationSteps(ctx context.Context, steps []configurationStep) error {
+	for _, step := range steps {
+		z.logger.LogDebug(ctx, "Adapter Initialisation: "+step.description)
+
+		if step.noRetry {
+			if err := step.invoke(ctx); err != nil {
+				return err
+			}
+		} else if err := z.retryFunctions(ctx, []func(context.Context) error{step.invoke}); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (z *ZStack) wipeAdapter(ctx context.Context) error {
-	return retryFunctions(ctx, []func(context.Context) error{
-		func(invokeCtx context.Context) error {
-			return z.writeNVRAM(invokeCtx, ZCDNVStartUpOption{StartOption: 0x03})
+	return z.runConfigurationSteps(ctx, z.wipeAdapterSteps())
+}
+
+func (z *ZStack) wipeAdapterSteps() []configurationStep {
+	return []configurationStep{
+		{
+			description: "Clear network state and configuration on next start up.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.writeNVRAM(invokeCtx, ZCDNVStartUpOption{StartOption: 0x03})
+			},
 		},
-		func(invokeCtx context.Context) error {
-			_, err := z.resetAdapter(invokeCtx, Soft)
-			return err
+		{
+			description: "Reset adapter.",
+			invoke: func(invokeCtx context.Context) error {
+				_, err := z.resetAdapter(invokeCtx, Soft)
+				return err
+			},
 		},
-	})
+	}
 }
 
 func (z *ZStack) makeCoordinator(ctx context.Context) error {
-	return retryFunctions(ctx, []func(context.Context) error{
-		func(invokeCtx context.Context) error {
-			return z.writeNVRAM(invokeCtx, ZCDNVLogicalType{LogicalType: zigbee.Coordinator})
+	return z.runConfigurationSteps(ctx, z.makeCoordinatorSteps())
+}
+
+func (z *ZStack) makeCoordinatorSteps() []configurationStep {
+	return []configurationStep{
+		{
+			description: "Set logical type to coordinator.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.writeNVRAM(invokeCtx, ZCDNVLogicalType{LogicalType: zigbee.Coordinator})
+			},
 		},
-		func(invokeCtx context.Context) error {
-			_, err := z.resetAdapter(invokeCtx, Soft)
-			return err
+		{
+			description: "Reset adapter.",
+			invoke: func(invokeCtx context.Context) error {
+				_, err := z.resetAdapter(invokeCtx, Soft)
+				return err
+			},
 		},
-	})
+	}
 }
 
 func (z *ZStack) configureNetwork(ctx context.Context, version Version) error {
-	channelBits := channelToBits(z.NetworkProperties.Channel)
+	return z.runConfigurationSteps(ctx, z.configureNetworkSteps(version))
+}
 
-	if err := retryFunctions(ctx, []func(context.Context) error{
-		func(invokeCtx context.Context) error {
-			z.logger.LogDebug(ctx, "Adapter Initialisation: Enabling preconfigured keys.")
-			return z.writeNVRAM(invokeCtx, ZCDNVPreCfgKeysEnable{Enabled: 1})
+func (z *ZStack) configureNetworkSteps(version Version) []configurationStep {
+	steps := []configurationStep{
+		{
+			description: "Enable preconfigured keys.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.writeNVRAM(invokeCtx, ZCDNVPreCfgKeysEnable{Enabled: 1})
+			},
 		},
-		func(invokeCtx context.Context) error {
-			z.logger.LogDebug(ctx, "Adapter Initialisation: Configuring network key.")
-			return z.writeNVRAM(invokeCtx, ZCDNVPreCfgKey{NetworkKey: z.NetworkProperties.NetworkKey})
+		{
+			description: "Configure network key.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.writeNVRAM(invokeCtx, ZCDNVPreCfgKey{NetworkKey: z.NetworkProperties.NetworkKey})
+			},
 		},
-		func(invokeCtx context.Context) error {
-			z.logger.LogDebug(ctx, "Adapter Initialisation: Enable ZDO callbacks.")
-			return z.writeNVRAM(invokeCtx, ZCDNVZDODirectCB{Enabled: 1})
+		{
+			description: "Enable ZDO callbacks.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.writeNVRAM(invokeCtx, ZCDNVZDODirectCB{Enabled: 1})
+			},
 		},
-		func(invokeCtx context.Context) error {
-			z.logger.LogDebug(ctx, "Adapter Initialisation: Configuring network channel.")
-			return z.writeNVRAM(invokeCtx, ZCDNVChanList{Channels: channelBits})
+		{
+			description: "Configure network channel.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.writeNVRAM(invokeCtx, ZCDNVChanList{Channels: channelToBits(z.NetworkProperties.Channel)})
+			},
 		},
-		func(invokeCtx context.Context) error {
-			z.logger.LogDebug(ctx, "Adapter Initialisation: Configuring network PANID.")
-			return z.writeNVRAM(invokeCtx, ZCDNVPANID{PANID: z.NetworkProperties.PANID})
+		{
+			description: "Configure network PANID.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.writeNVRAM(invokeCtx, ZCDNVPANID{PANID: z.NetworkProperties.PANID})
+			},
 		},
-		func(invokeCtx context.Context) error {
-			z.logger.LogDebug(ctx, "Adapter Initialisation: Configuring network extended PANID.")
-			return z.writeNVRAM(invokeCtx, ZCDNVExtPANID{ExtendedPANID: z.NetworkProperties.ExtendedPANID})
+		{
+			description: "Configure network extended PANID.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.writeNVRAM(invokeCtx, ZCDNVExtPANID{ExtendedPANID: z.NetworkProperties.ExtendedPANID})
+			},
 		},
-	}); err != nil {
-		return err
 	}
 
 	if !version.IsV3() {
-		z.logger.LogDebug(ctx, "Adapter Initialisation: Not Version 3.X.X.")
 		/* Less than Z-Stack 3.X.X requires the Trust Centre key to be loaded. */
-		return retryFunctions(ctx, []func(context.Context) error{
-			func(invokeCtx context.Context) error {
-				z.logger.LogDebug(ctx, "Adapter Initialisation: Enable default trust center.")
-				return z.writeNVRAM(invokeCtx, ZCDNVUseDefaultTCLK{Enabled: 1})
+		return append(steps,
+			configurationStep{
+				description: "Enable default trust center.",
+				invoke: func(invokeCtx context.Context) error {
+					return z.writeNVRAM(invokeCtx, ZCDNVUseDefaultTCLK{Enabled: 1})
+				},
 			},
-			func(invokeCtx context.Context) error {
-				z.logger.LogDebug(ctx, "Adapter Initialisation: Configuring ZLL trust center key.")
-				return z.writeNVRAM(invokeCtx, ZCDNVTCLKTableStart{
-					Address:        zigbee.IEEEAddress(0xffffffffffffffff),
-					NetworkKey:     zigbee.TCLinkKey,
-					TXFrameCounter: 0,
-					RXFrameCounter: 0,
-				})
+			configurationStep{
+				description: "Configure ZLL trust center key.",
+				invoke: func(invokeCtx context.Context) error {
+					return z.writeNVRAM(invokeCtx, ZCDNVTCLKTableStart{
+						Address:        zigbee.IEEEAddress(0xffffffffffffffff),
+						NetworkKey:     zigbee.TCLinkKey,
+						TXFrameCounter: 0,
+						RXFrameCounter: 0,
+					})
+				},
 			},
-		})
-	} else {
-		/* Z-Stack 3.X.X requires configuration of Base Device Behaviour. */
-		z.logger.LogDebug(ctx, "Adapter Initialisation: Version 3.X.X.")
-		if err := retryFunctions(ctx, []func(context.Context) error{
-			func(invokeCtx context.Context) error {
-				z.logger.LogDebug(ctx, "Adapter Initialisation: Configure primary channel.")
-				return z.requestResponder.RequestResponse(ctx, APPCNFBDBSetChannelRequest{IsPrimary: true, Channel: channelBits}, &APPCNFBDBSetChannelRequestReply{})
+		)
+	}
+
+	/* Z-Stack 3.X.X requires configuration of Base Device Behaviour. */
+	return append(steps,
+		configurationStep{
+			description: "Configure primary channel.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.requestResponder.RequestResponse(invokeCtx, APPCNFBDBSetChannelRequest{IsPrimary: true, Channel: channelToBits(z.NetworkProperties.Channel)}, &APPCNFBDBSetChannelRequestReply{})
 			},
-			func(invokeCtx context.Context) error {
-				z.logger.LogDebug(ctx, "Adapter Initialisation: Configure secondary channels.")
-				return z.requestResponder.RequestResponse(ctx, APPCNFBDBSetChannelRequest{IsPrimary: false, Channel: [4]byte{}}, &APPCNFBDBSetChannelRequestReply{})
+		},
+		configurationStep{
+			description: "Configure secondary channels.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.requestResponder.RequestResponse(invokeCtx, APPCNFBDBSetChannelRequest{IsPrimary: false, Channel: [4]byte{}}, &APPCNFBDBSetChannelRequestReply{})
 			},
-			func(invokeCtx context.Context) error {
-				z.logger.LogDebug(ctx, "Adapter Initialisation: Request commissioning.")
-				return z.requestResponder.RequestResponse(ctx, APPCNFBDBStartCommissioningRequest{Mode: 0x04}, &APPCNFBDBStartCommissioningRequestReply{})
+		},
+		configurationStep{
+			description: "Request commissioning.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.requestResponder.RequestResponse(invokeCtx, APPCNFBDBStartCommissioningRequest{Mode: 0x04}, &APPCNFBDBStartCommissioningRequestReply{})
 			},
-		}); err != nil {
-			return err
-		}
-
-		z.logger.LogDebug(ctx, "Adapter Initialisation: Waiting for coordinator to start.")
-		if err := z.waitForCoordinatorStart(ctx); err != nil {
-			return err
-		}
-
-		return retryFunctions(ctx, []func(context.Context) error{
-			func(invokeCtx context.Context) error {
-				z.logger.LogDebug(ctx, "Adapter Initialisation: Waiting for commissioning to complete.")
-				return z.requestResponder.RequestResponse(ctx, APPCNFBDBStartCommissioningRequest{Mode: 0x02}, &APPCNFBDBStartCommissioningRequestReply{})
+		},
+		configurationStep{
+			description: "Wait for coordinator to start.",
+			noRetry:     true,
+			invoke:      z.waitForCoordinatorStart,
+		},
+		configurationStep{
+			description: "Wait for commissioning to complete.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.requestResponder.RequestResponse(invokeCtx, APPCNFBDBStartCommissioningRequest{Mode: 0x02}, &APPCNFBDBStartCommissioningRequestReply{})
 			},
-		})
-	}
+		},
+	)
 }
 
 func (z *ZStack) retrieveAdapterAddresses(ctx context.Context) error {
-	return retryFunctions(ctx, []func(context.Context) error{
+	return z.retryFunctions(ctx, []func(context.Context) error{
 		func(invokeCtx context.Context) error {
-			if address, err := z.GetAdapterIEEEAddress(ctx); err != nil {
+			if info, err := z.getAddressInfo(ctx); err != nil {
 				return err
 			} else {
-				z.NetworkProperties.IEEEAddress = address
+				z.NetworkProperties.IEEEAddress = info.IEEEAddress
 				return nil
 			}
 		},
 		func(ctx context.Context) error {
-			if address, err := z.GetAdapterNetworkAddress(ctx); err != nil {
+			if info, err := z.getAddressInfo(ctx); err != nil {
 				return err
 			} else {
-				z.NetworkProperties.NetworkAddress = address
+				z.NetworkProperties.NetworkAddress = info.NetworkAddress
 				return nil
 			}
 		},
@@ -239,7 +405,7 @@ func (z *ZStack) retrieveAdapterAddresses(ctx context.Context) error {
 }
 
 func (z *ZStack) startZigbeeStack(ctx context.Context, version Version) error {
-	if err := retry.Retry(ctx, DefaultZStackTimeout, DefaultZStackRetries, func(invokeCtx context.Context) error {
+	if err := retry.Retry(ctx, z.config.timeout, z.config.retries, func(invokeCtx context.Context) error {
 		return z.requestResponder.RequestResponse(invokeCtx, ZDOStartUpFromAppRequest{StartDelay: 100}, &ZDOStartUpFromAppRequestReply{})
 	}); err != nil {
 		return err
@@ -298,9 +464,9 @@ func (z *ZStack) waitForCoordinatorStart(ctx context.Context) error {
 	}
 }
 
-func retryFunctions(ctx context.Context, funcs []func(context.Context) error) error {
+func (z *ZStack) retryFunctions(ctx context.Context, funcs []func(context.Context) error) error {
 	for _, f := range funcs {
-		if err := retry.Retry(ctx, DefaultZStackTimeout, DefaultZStackRetries, f); err != nil {
+		if err := retry.Retry(ctx, z.config.timeout, z.config.retries, f); err != nil {
 			return fmt.Errorf("failed during configuration and initialisation: %w", err)
 		}
 	}
@@ -320,6 +486,18 @@ func channelToBits(channel uint8) [4]byte {
 	return channelBytes
 }
 
+func bitsToChannel(channelBytes [4]byte) uint8 {
+	channelBits := uint32(channelBytes[0]) | uint32(channelBytes[1])<<8 | uint32(channelBytes[2])<<16 | uint32(channelBytes[3])<<24
+
+	for _, channel := range zigbee.Channels {
+		if channelBits&(1<<channel) != 0 {
+			return channel
+		}
+	}
+
+	return 0
+}
+
 type ZBStartStatus uint8
 
 const (
@@ -20,7 +20,7 @@ func Test_Initialise(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
 		defer unpiMock.Stop()
-		defer zstack.Stop()
+		defer zstack.Stop(context.Background())
 
 		resetResponse, _ := bytecodec.Marshal(SysResetInd{
 			Reason:  External,
@@ -86,11 +86,17 @@ func Test_Initialise(t *testing.T) {
 
 		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
 			logicalTypeFrame,
-		).Times(1)
+			nvramReadFrame(ZCDNVPANID{}),
+			nvramReadFrame(ZCDNVExtPANID{}),
+			nvramReadFrame(ZCDNVChanList{}),
+			nvramReadFrame(ZCDNVPreCfgKeysEnable{}),
+			nvramReadFrame(ZCDNVPreCfgKey{}),
+		).Times(6)
 
 		err := zstack.Initialise(ctx, nc)
 
 		assert.NoError(t, err)
+		assert.Equal(t, Running, zstack.State())
 		unpiMock.AssertCalls(t)
 
 		assert.Equal(t, nc.PANID, zstack.NetworkProperties.PANID)
@@ -123,7 +129,7 @@ func Test_Initialise(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
 		defer unpiMock.Stop()
-		defer zstack.Stop()
+		defer zstack.Stop(context.Background())
 
 		resetResponse, _ := bytecodec.Marshal(SysResetInd{
 			Reason:  External,
@@ -212,7 +218,12 @@ func Test_Initialise(t *testing.T) {
 
 		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
 			logicalTypeFrame,
-		).Times(1)
+			nvramReadFrame(ZCDNVPANID{}),
+			nvramReadFrame(ZCDNVExtPANID{}),
+			nvramReadFrame(ZCDNVChanList{}),
+			nvramReadFrame(ZCDNVPreCfgKeysEnable{}),
+			nvramReadFrame(ZCDNVPreCfgKey{}),
+		).Times(6)
 
 		err := zstack.Initialise(ctx, nc)
 
@@ -251,7 +262,7 @@ func Test_Initialise(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
 		defer unpiMock.Stop()
-		defer zstack.Stop()
+		defer zstack.Stop(context.Background())
 
 		resetResponse, _ := bytecodec.Marshal(SysResetInd{
 			Reason:  External,
@@ -324,10 +335,13 @@ func Test_Initialise(t *testing.T) {
 			panidFrame,
 			extPANIdFrame,
 			chanListFrame,
-		).Times(4)
+			nvramReadFrame(ZCDNVPreCfgKeysEnable{Enabled: 1}),
+			nvramReadFrame(ZCDNVPreCfgKey{NetworkKey: nc.NetworkKey}),
+		).Times(6)
 
 		err := zstack.Initialise(ctx, nc)
 		assert.NoError(t, err)
+		assert.Equal(t, Running, zstack.State())
 
 		adapterNode := zstack.AdapterNode()
 		assert.Equal(t, zigbee.IEEEAddress(0x8090a0b0c0d0e0f), adapterNode.IEEEAddress)
@@ -356,7 +370,7 @@ func Test_verifyAdapterNetworkConfig(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
 		defer unpiMock.Stop()
-		defer zstack.Stop()
+		defer zstack.Stop(context.Background())
 
 		nc := zigbee.NetworkConfiguration{
 			PANID:         zigbee.PANID(0x0102),
@@ -391,12 +405,14 @@ func Test_verifyAdapterNetworkConfig(t *testing.T) {
 			panidFrame,
 			extPANIdFrame,
 			chanListFrame,
-		).Times(4)
+			nvramReadFrame(ZCDNVPreCfgKeysEnable{Enabled: 1}),
+			nvramReadFrame(ZCDNVPreCfgKey{NetworkKey: nc.NetworkKey}),
+		).Times(6)
 
-		valid, err := zstack.verifyAdapterNetworkConfig(ctx, Version{})
+		verification, err := zstack.verifyAdapterNetworkConfig(ctx, nc)
 
 		assert.NoError(t, err)
-		assert.True(t, valid)
+		assert.True(t, verification.Valid())
 		unpiMock.AssertCalls(t)
 	})
 
@@ -407,7 +423,7 @@ func Test_verifyAdapterNetworkConfig(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
 		defer unpiMock.Stop()
-		defer zstack.Stop()
+		defer zstack.Stop(context.Background())
 
 		nc := zigbee.NetworkConfiguration{
 			PANID:         zigbee.PANID(0x0102),
@@ -442,12 +458,235 @@ func Test_verifyAdapterNetworkConfig(t *testing.T) {
 			panidFrame,
 			extPANIdFrame,
 			chanListFrame,
-		).Times(4)
+			nvramReadFrame(ZCDNVPreCfgKeysEnable{Enabled: 1}),
+			nvramReadFrame(ZCDNVPreCfgKey{NetworkKey: nc.NetworkKey}),
+		).Times(6)
 
-		valid, err := zstack.verifyAdapterNetworkConfig(ctx, Version{})
+		verification, err := zstack.verifyAdapterNetworkConfig(ctx, nc)
 
 		assert.NoError(t, err)
-		assert.False(t, valid)
+		assert.False(t, verification.Valid())
+		assert.Equal(t, []NetworkConfigMismatch{
+			{Item: "ZCDNVChanList", Expected: ZCDNVChanList{Channels: channelToBits(nc.Channel)}, Actual: ZCDNVChanList{Channels: channelToBits(23)}},
+		}, verification.Mismatches)
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("incorrect network key and disabled preconfigured keys results in invalid", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		nc := zigbee.NetworkConfiguration{
+			PANID:         zigbee.PANID(0x0102),
+			ExtendedPANID: zigbee.ExtendedPANID(0x0102030405060708),
+			NetworkKey:    [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			Channel:       zigbee.DefaultChannel,
+		}
+
+		zstack.NetworkProperties.PANID = nc.PANID
+		zstack.NetworkProperties.ExtendedPANID = nc.ExtendedPANID
+		zstack.NetworkProperties.NetworkKey = nc.NetworkKey
+		zstack.NetworkProperties.Channel = nc.Channel
+
+		otherKey := zigbee.NetworkKey{0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}
+
+		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
+			nvramReadFrame(ZCDNVLogicalType{LogicalType: zigbee.Coordinator}),
+			nvramReadFrame(ZCDNVPANID{PANID: nc.PANID}),
+			nvramReadFrame(ZCDNVExtPANID{ExtendedPANID: nc.ExtendedPANID}),
+			nvramReadFrame(ZCDNVChanList{Channels: channelToBits(nc.Channel)}),
+			nvramReadFrame(ZCDNVPreCfgKeysEnable{Enabled: 0}),
+			nvramReadFrame(ZCDNVPreCfgKey{NetworkKey: otherKey}),
+		).Times(6)
+
+		verification, err := zstack.verifyAdapterNetworkConfig(ctx, nc)
+
+		assert.NoError(t, err)
+		assert.False(t, verification.Valid())
+		assert.Equal(t, []NetworkConfigMismatch{
+			{Item: "ZCDNVPreCfgKeysEnable", Expected: ZCDNVPreCfgKeysEnable{Enabled: 1}, Actual: ZCDNVPreCfgKeysEnable{Enabled: 0}},
+			{Item: "ZCDNVPreCfgKey", Expected: ZCDNVPreCfgKey{NetworkKey: nc.NetworkKey}, Actual: ZCDNVPreCfgKey{NetworkKey: otherKey}},
+		}, verification.Mismatches)
+		unpiMock.AssertCalls(t)
+	})
+}
+
+func Test_DiagnoseAdapter(t *testing.T) {
+	t.Run("an adapter with incorrect config reports a full reconfiguration without writing to NVRAM", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		resetResponse, _ := bytecodec.Marshal(SysResetInd{
+			Reason:  External,
+			Version: Version{},
+		})
+
+		unpiMock.On(AREQ, SYS, SysResetReqID).Return(Frame{
+			MessageType: AREQ,
+			Subsystem:   SYS,
+			CommandID:   SysResetIndID,
+			Payload:     resetResponse,
+		}).Times(1)
+
+		nc := zigbee.NetworkConfiguration{
+			PANID:         zigbee.PANID(0x0102),
+			ExtendedPANID: zigbee.ExtendedPANID(0x0102030405060708),
+			NetworkKey:    [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			Channel:       zigbee.DefaultChannel,
+		}
+
+		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
+			nvramReadFrame(ZCDNVLogicalType{LogicalType: zigbee.EndDevice}),
+			nvramReadFrame(ZCDNVPANID{PANID: nc.PANID}),
+			nvramReadFrame(ZCDNVExtPANID{ExtendedPANID: nc.ExtendedPANID}),
+			nvramReadFrame(ZCDNVChanList{Channels: channelToBits(nc.Channel)}),
+			nvramReadFrame(ZCDNVPreCfgKeysEnable{Enabled: 1}),
+			nvramReadFrame(ZCDNVPreCfgKey{NetworkKey: nc.NetworkKey}),
+		).Times(6)
+
+		diagnosis, err := zstack.DiagnoseAdapter(ctx, nc)
+		assert.NoError(t, err)
+
+		assert.False(t, diagnosis.Verification.Valid())
+		assert.Equal(t, "ZCDNVLogicalType", diagnosis.Verification.Mismatches[0].Item)
+
+		var expectedActions []string
+		for _, step := range zstack.initialiseSteps(Version{}, diagnosis.Verification) {
+			expectedActions = append(expectedActions, step.description)
+		}
+
+		assert.Equal(t, expectedActions, diagnosis.Actions)
+		assert.Contains(t, diagnosis.Actions, "Configure network key.")
+		assert.Contains(t, diagnosis.Actions, "Configure ZLL trust center key.")
+		assert.Equal(t, zigbee.PANID(0), zstack.NetworkProperties.PANID)
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("an adapter with correct config only reports starting the network", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		resetResponse, _ := bytecodec.Marshal(SysResetInd{
+			Reason:  External,
+			Version: Version{ProductID: 1},
+		})
+
+		unpiMock.On(AREQ, SYS, SysResetReqID).Return(Frame{
+			MessageType: AREQ,
+			Subsystem:   SYS,
+			CommandID:   SysResetIndID,
+			Payload:     resetResponse,
+		}).Times(1)
+
+		nc := zigbee.NetworkConfiguration{
+			PANID:         zigbee.PANID(0x0102),
+			ExtendedPANID: zigbee.ExtendedPANID(0x0102030405060708),
+			NetworkKey:    [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			Channel:       zigbee.DefaultChannel,
+		}
+
+		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
+			nvramReadFrame(ZCDNVLogicalType{LogicalType: zigbee.Coordinator}),
+			nvramReadFrame(ZCDNVPANID{PANID: nc.PANID}),
+			nvramReadFrame(ZCDNVExtPANID{ExtendedPANID: nc.ExtendedPANID}),
+			nvramReadFrame(ZCDNVChanList{Channels: channelToBits(nc.Channel)}),
+			nvramReadFrame(ZCDNVPreCfgKeysEnable{Enabled: 1}),
+			nvramReadFrame(ZCDNVPreCfgKey{NetworkKey: nc.NetworkKey}),
+		).Times(6)
+
+		diagnosis, err := zstack.DiagnoseAdapter(ctx, nc)
+		assert.NoError(t, err)
+
+		assert.True(t, diagnosis.Verification.Valid())
+		assert.True(t, diagnosis.Version.IsV3())
+		assert.Equal(t, []string{
+			"Start Zigbee stack.",
+			"Fetch adapter IEEE and network addresses.",
+			"Enforce denial of network joins.",
+			"Start network manager, message receiver, adapter monitor and health check.",
+		}, diagnosis.Actions)
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("an adapter on a persisted channel is not reported as needing a wipe", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		resetResponse, _ := bytecodec.Marshal(SysResetInd{
+			Reason:  External,
+			Version: Version{ProductID: 1},
+		})
+
+		unpiMock.On(AREQ, SYS, SysResetReqID).Return(Frame{
+			MessageType: AREQ,
+			Subsystem:   SYS,
+			CommandID:   SysResetIndID,
+			Payload:     resetResponse,
+		}).Times(1)
+
+		nc := zigbee.NetworkConfiguration{
+			PANID:         zigbee.PANID(0x0102),
+			ExtendedPANID: zigbee.ExtendedPANID(0x0102030405060708),
+			NetworkKey:    [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			Channel:       zigbee.DefaultChannel,
+		}
+
+		zstack.NetworkProperties.ExtendedPANID = nc.ExtendedPANID
+		zstack.persistChannel(20)
+
+		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
+			nvramReadFrame(ZCDNVLogicalType{LogicalType: zigbee.Coordinator}),
+			nvramReadFrame(ZCDNVPANID{PANID: nc.PANID}),
+			nvramReadFrame(ZCDNVExtPANID{ExtendedPANID: nc.ExtendedPANID}),
+			nvramReadFrame(ZCDNVChanList{Channels: channelToBits(20)}),
+			nvramReadFrame(ZCDNVPreCfgKeysEnable{Enabled: 1}),
+			nvramReadFrame(ZCDNVPreCfgKey{NetworkKey: nc.NetworkKey}),
+		).Times(6)
+
+		diagnosis, err := zstack.DiagnoseAdapter(ctx, nc)
+		assert.NoError(t, err)
+		assert.True(t, diagnosis.Verification.Valid())
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("refuses to reset an adapter which is running", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.state = Running
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		_, err := zstack.DiagnoseAdapter(ctx, zigbee.NetworkConfiguration{})
+		assert.ErrorIs(t, err, ErrAdapterNotReady)
+
+		time.Sleep(10 * time.Millisecond)
+		assert.Empty(t, unpiMock.ReceivedFrames)
 		unpiMock.AssertCalls(t)
 	})
 }
@@ -647,3 +886,15 @@ func Test_APPCNFBDBStructs(t *testing.T) {
 		assert.Equal(t, expectedBytes, actualBytes)
 	})
 }
+
+func Test_bitsToChannel(t *testing.T) {
+	t.Run("converts channel bits back into the channel", func(t *testing.T) {
+		for _, channel := range zigbee.Channels {
+			assert.Equal(t, channel, bitsToChannel(channelToBits(channel)))
+		}
+	})
+
+	t.Run("returns zero if no channel is set", func(t *testing.T) {
+		assert.Equal(t, uint8(0), bitsToChannel([4]byte{}))
+	})
+}
@@ -0,0 +1,152 @@
+package zstack
+
+import (
+	"context"
+	"fmt"
+	"github.com/shimmeringbee/logwrap"
+	"github.com/shimmeringbee/retry"
+	"github.com/shimmeringbee/zigbee"
+	"time"
+)
+
+const DefaultAdapterRecoveryTimeout = 30 * time.Second
+const DefaultAdapterRecoveryAttempts = 3
+const DefaultAdapterRecoveryBackoff = 5 * time.Second
+
+/*
+Configures how many times recovery from an unexpected adapter reset is attempted, doubling the backoff between each. If
+every attempt fails the adapter enters the Faulted state, and must be initialised again.
+*/
+func WithAdapterRecovery(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.recoveryAttempts = attempts
+		o.recoveryBackoff = backoff
+	}
+}
+
+type AdapterRestartedEvent struct {
+	Version Version
+}
+
+type AdapterRecoveryFailedEvent struct {
+	Version Version
+	Attempt int
+	Err     error
+	Final   bool
+}
+
+func (z *ZStack) startAdapterMonitor() {
+	z.stopAdapterMonitor()
+
+	_, stopReset := z.subscriber.Subscribe(&SysResetInd{}, func(v interface{}) {
+		msg := v.(*SysResetInd)
+		z.logger.LogWarn(context.Background(), "Adapter reset unexpectedly.", logwrap.Datum("Reason", msg.Reason))
+		z.goBackground(func() { z.recoverAdapter(msg.Version) })
+	})
+
+	_, stopStateChange := z.subscriber.Subscribe(&ZDOStateChangeInd{}, func(v interface{}) {
+		msg := v.(*ZDOStateChangeInd)
+
+		if msg.State == DeviceZBCoordinator || msg.State == DeviceCoordinatorStarting {
+			return
+		}
+
+		z.logger.LogWarn(context.Background(), "Adapter is no longer a started coordinator.", logwrap.Datum("State", msg.State))
+		z.goBackground(func() { z.recoverAdapter(z.adapterVersion) })
+	})
+
+	z.adapterMonitorStop = []func(){stopReset, stopStateChange}
+}
+
+func (z *ZStack) stopAdapterMonitor() {
+	for _, stop := range z.adapterMonitorStop {
+		if stop != nil {
+			stop()
+		}
+	}
+
+	z.adapterMonitorStop = nil
+}
+
+func (z *ZStack) recoverAdapter(version Version) {
+	if !z.adapterMonitorRecovering.CompareAndSwap(false, true) {
+		return
+	}
+	defer z.adapterMonitorRecovering.Store(false)
+
+	if !z.transitionState(Running, Configuring) {
+		return
+	}
+
+	backoff := z.config.recoveryBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := z.attemptAdapterRecovery(version)
+		if err == nil {
+			if z.transitionState(Configuring, Running) {
+				z.sendEvent(AdapterRestartedEvent{Version: version})
+			}
+			return
+		}
+
+		final := attempt >= z.config.recoveryAttempts
+		z.logger.LogError(z.ctx, "Failed to recover adapter after reset.", logwrap.Err(err), logwrap.Datum("Attempt", attempt), logwrap.Datum("Final", final))
+
+		if z.ctx.Err() != nil {
+			return
+		}
+
+		z.sendEvent(AdapterRecoveryFailedEvent{Version: version, Attempt: attempt, Err: err, Final: final})
+
+		if final {
+			z.transitionState(Configuring, Faulted)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-z.ctx.Done():
+			return
+		}
+
+		backoff *= 2
+	}
+}
+
+func (z *ZStack) attemptAdapterRecovery(version Version) error {
+	ctx, cancel := context.WithTimeout(z.ctx, DefaultAdapterRecoveryTimeout)
+	defer cancel()
+
+	ctx, segmentEnd := z.logger.Segment(ctx, "Adapter Recovery.")
+	defer segmentEnd()
+
+	return z.restoreAdapterState(ctx, version)
+}
+
+func (z *ZStack) restoreAdapterState(ctx context.Context, version Version) error {
+	z.adapterVersion = version
+
+	z.logger.LogInfo(ctx, "Starting Zigbee stack.")
+	if err := z.startZigbeeStack(ctx, version); err != nil {
+		return err
+	}
+
+	z.logger.LogInfo(ctx, "Registering adapter endpoints.")
+	for _, endpoint := range z.adapterEndpoints() {
+		if err := retry.Retry(ctx, z.config.timeout, z.config.retries, func(invokeCtx context.Context) error {
+			return z.registerAdapterEndpoint(invokeCtx, endpoint)
+		}); err != nil {
+			return fmt.Errorf("failed to register adapter endpoint %d: %w", endpoint.Endpoint, err)
+		}
+	}
+
+	z.logger.LogInfo(ctx, "Restoring network join state.")
+	switch z.NetworkProperties.JoinState {
+	case OnCoordinator:
+		return z.sendJoin(ctx, z.NetworkProperties.NetworkAddress, JoiningOn, OnCoordinator)
+	case OnAllRouters:
+		return z.sendJoin(ctx, zigbee.BroadcastRoutersCoordinators, JoiningOn, OnAllRouters)
+	default:
+		return z.sendJoin(ctx, zigbee.BroadcastRoutersCoordinators, JoiningOff, Off)
+	}
+}
@@ -0,0 +1,151 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_AdapterMonitor(t *testing.T) {
+	t.Run("an unexpected adapter reset restarts the stack, registers endpoints and restores join state", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		zstack.NetworkProperties.JoinState = OnAllRouters
+		defer unpiMock.Stop()
+		defer zstack.stopAdapterMonitor()
+
+		zstack.rememberAdapterEndpoint(AFRegister{Endpoint: 0x01, AppProfileId: 0x0104})
+
+		unpiMock.On(SREQ, ZDO, ZDOStartUpFromAppRequestId).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZDOStartUpFromAppRequestReplyID,
+			Payload:     []byte{0x00},
+		}).Times(1)
+
+		registerCall := unpiMock.On(SREQ, AF, AFRegisterID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AFRegisterReplyID,
+			Payload:     []byte{0x00},
+		}).Times(1)
+
+		joinCall := unpiMock.On(SREQ, ZDO, ZDOMgmtPermitJoinRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZDOMgmtPermitJoinRequestReplyID,
+			Payload:     []byte{0x00},
+		}).Times(1)
+
+		zstack.startAdapterMonitor()
+
+		version := Version{ProductID: 1, MajorRelease: 2, MinorRelease: 7}
+		resetInd, _ := bytecodec.Marshal(SysResetInd{Reason: Watchdog, Version: version})
+
+		unpiMock.InjectOutgoing(Frame{
+			MessageType: AREQ,
+			Subsystem:   SYS,
+			CommandID:   SysResetIndID,
+			Payload:     resetInd,
+		})
+
+		assert.Equal(t, AdapterStateChangeEvent{Previous: Running, Current: Configuring}, readEvent(t, ctx, zstack))
+		assert.Equal(t, AdapterStateChangeEvent{Previous: Configuring, Current: Running}, readEvent(t, ctx, zstack))
+		assert.Equal(t, AdapterRestartedEvent{Version: version}, readEvent(t, ctx, zstack))
+
+		register := AFRegister{}
+		bytecodec.Unmarshal(registerCall.CapturedCalls[0].Frame.Payload, &register)
+		assert.Equal(t, zigbee.Endpoint(0x01), register.Endpoint)
+
+		join := ZDOMgmtPermitJoinRequest{}
+		bytecodec.Unmarshal(joinCall.CapturedCalls[0].Frame.Payload, &join)
+		assert.Equal(t, zigbee.BroadcastRoutersCoordinators, join.Destination)
+		assert.Equal(t, JoiningOn, join.Duration)
+		assert.Equal(t, OnAllRouters, zstack.NetworkProperties.JoinState)
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("a failed recovery is retried and then faults the adapter", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New(), WithTimeout(10*time.Millisecond), WithRetries(1), WithAdapterRecovery(2, 10*time.Millisecond))
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+		defer zstack.stopAdapterMonitor()
+
+		zstack.startAdapterMonitor()
+
+		version := Version{ProductID: 1}
+		resetInd, _ := bytecodec.Marshal(SysResetInd{Reason: Watchdog, Version: version})
+
+		unpiMock.InjectOutgoing(Frame{
+			MessageType: AREQ,
+			Subsystem:   SYS,
+			CommandID:   SysResetIndID,
+			Payload:     resetInd,
+		})
+
+		assert.Equal(t, AdapterStateChangeEvent{Previous: Running, Current: Configuring}, readEvent(t, ctx, zstack))
+
+		first, ok := readEvent(t, ctx, zstack).(AdapterRecoveryFailedEvent)
+		assert.True(t, ok)
+		assert.Equal(t, 1, first.Attempt)
+		assert.False(t, first.Final)
+		assert.Error(t, first.Err)
+
+		second, ok := readEvent(t, ctx, zstack).(AdapterRecoveryFailedEvent)
+		assert.True(t, ok)
+		assert.Equal(t, 2, second.Attempt)
+		assert.True(t, second.Final)
+
+		assert.Equal(t, AdapterStateChangeEvent{Previous: Configuring, Current: Faulted}, readEvent(t, ctx, zstack))
+		assert.ErrorIs(t, zstack.checkReady(), ErrAdapterNotReady)
+	})
+
+	t.Run("a coordinator state change does not trigger recovery", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+		defer zstack.stopAdapterMonitor()
+
+		zstack.startAdapterMonitor()
+
+		unpiMock.InjectOutgoing(Frame{
+			MessageType: AREQ,
+			Subsystem:   ZDO,
+			CommandID:   ZDOStateChangeIndID,
+			Payload:     []byte{byte(DeviceZBCoordinator)},
+		})
+
+		_, err := zstack.ReadEvent(ctx)
+		assert.Error(t, err)
+
+		unpiMock.AssertCalls(t)
+	})
+}
+
+func readEvent(t *testing.T, ctx context.Context, zstack *ZStack) interface{} {
+	event, err := zstack.ReadEvent(ctx)
+	assert.NoError(t, err)
+	return event
+}
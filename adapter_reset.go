@@ -2,6 +2,69 @@ package zstack
 
 import "context"
 
+func (z *ZStack) FactoryReset(pctx context.Context) (Version, error) {
+	ctx, segmentEnd := z.logger.Segment(pctx, "Adapter Factory Reset.")
+	defer segmentEnd()
+
+	if err := z.enterResetting(); err != nil {
+		return Version{}, err
+	}
+
+	z.logger.LogInfo(ctx, "Restarting adapter.")
+	version, err := z.waitForAdapterReset(ctx)
+	if err != nil {
+		return Version{}, err
+	}
+
+	z.setState(Configuring)
+
+	z.logger.LogInfo(ctx, "Clearing network state.")
+	if err := z.runConfigurationSteps(ctx, z.factoryResetSteps(version)); err != nil {
+		return Version{}, err
+	}
+
+	z.logger.LogInfo(ctx, "Restarting adapter.")
+	version, err = z.waitForAdapterReset(ctx)
+	if err != nil {
+		return Version{}, err
+	}
+
+	z.adapterVersion = version
+	z.setState(Uninitialised)
+
+	return version, nil
+}
+
+func (z *ZStack) factoryResetSteps(version Version) []configurationStep {
+	steps := []configurationStep{
+		{
+			description: "Clear network state and configuration on next start up.",
+			invoke: func(invokeCtx context.Context) error {
+				return z.writeNVRAM(invokeCtx, ZCDNVStartUpOption{StartOption: 0x03})
+			},
+		},
+	}
+
+	if version.IsV3() {
+		steps = append(steps,
+			configurationStep{
+				description: "Delete BDB network membership.",
+				invoke: func(invokeCtx context.Context) error {
+					return z.deleteNVRAMByID(invokeCtx, ZCDNVBDBNodeIsOnANetworkID)
+				},
+			},
+			configurationStep{
+				description: "Delete network information base.",
+				invoke: func(invokeCtx context.Context) error {
+					return z.deleteNVRAMByID(invokeCtx, ZCDNVNIBID)
+				},
+			},
+		)
+	}
+
+	return steps
+}
+
 func (z *ZStack) resetAdapter(ctx context.Context, resetType ResetType) (Version, error) {
 	resetInd := &SysResetInd{}
 	err := z.requestResponder.RequestResponse(ctx, SysResetReq{ResetType: resetType}, resetInd)
@@ -46,4 +109,8 @@ func (v Version) IsV3() bool {
 	return v.ProductID > 0
 }
 
+func (v Version) IsV3x0() bool {
+	return v.ProductID > 1
+}
+
 const SysResetIndID uint8 = 0x80
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"testing"
@@ -99,3 +102,96 @@ func Test_Version(t *testing.T) {
 		assert.True(t, Version{ProductID: 2}.IsV3())
 	})
 }
+
+func TestZStack_FactoryReset(t *testing.T) {
+	t.Run("a z-stack 3.X.X adapter has its network state cleared and reports the post reset version", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		expectedVersion := Version{TransportRevision: 2, ProductID: 1, MajorRelease: 2, MinorRelease: 7}
+
+		resetResponse, _ := bytecodec.Marshal(SysResetInd{Reason: External, Version: expectedVersion})
+		unpiMock.On(AREQ, SYS, SysResetReqID).Return(Frame{
+			MessageType: AREQ,
+			Subsystem:   SYS,
+			CommandID:   SysResetIndID,
+			Payload:     resetResponse,
+		}).Times(2)
+
+		nvramWriteResponse, _ := bytecodec.Marshal(SysOSALNVWriteReply{Status: ZSuccess})
+		writeCall := unpiMock.On(SREQ, SYS, SysOSALNVWriteID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysOSALNVWriteReplyID,
+			Payload:     nvramWriteResponse,
+		}).Times(1)
+
+		unpiMock.On(SREQ, SYS, SysOSALNVLengthID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysOSALNVLengthReplyID,
+			Payload:     []byte{0x01, 0x00},
+		}).Times(2)
+
+		deleteCall := unpiMock.On(SREQ, SYS, SysOSALNVDeleteID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysOSALNVDeleteReplyID,
+			Payload:     []byte{0x00},
+		}).Times(2)
+
+		version, err := zstack.FactoryReset(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedVersion, version)
+
+		write := SysOSALNVWrite{}
+		bytecodec.Unmarshal(writeCall.CapturedCalls[0].Frame.Payload, &write)
+		assert.Equal(t, ZCDNVStartUpOptionID, write.NVItemID)
+		assert.Equal(t, []byte{0x03}, write.Value)
+
+		firstDelete := SysOSALNVDelete{}
+		bytecodec.Unmarshal(deleteCall.CapturedCalls[0].Frame.Payload, &firstDelete)
+		assert.Equal(t, SysOSALNVDelete{NVItemID: ZCDNVBDBNodeIsOnANetworkID, Length: 1}, firstDelete)
+
+		secondDelete := SysOSALNVDelete{}
+		bytecodec.Unmarshal(deleteCall.CapturedCalls[1].Frame.Payload, &secondDelete)
+		assert.Equal(t, ZCDNVNIBID, secondDelete.NVItemID)
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("a z-stack 1.2.X adapter only has its start up option set", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		resetResponse, _ := bytecodec.Marshal(SysResetInd{Reason: External, Version: Version{}})
+		unpiMock.On(AREQ, SYS, SysResetReqID).Return(Frame{
+			MessageType: AREQ,
+			Subsystem:   SYS,
+			CommandID:   SysResetIndID,
+			Payload:     resetResponse,
+		}).Times(2)
+
+		nvramWriteResponse, _ := bytecodec.Marshal(SysOSALNVWriteReply{Status: ZSuccess})
+		unpiMock.On(SREQ, SYS, SysOSALNVWriteID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysOSALNVWriteReplyID,
+			Payload:     nvramWriteResponse,
+		}).Times(1)
+
+		version, err := zstack.FactoryReset(ctx)
+		assert.NoError(t, err)
+		assert.False(t, version.IsV3())
+
+		unpiMock.AssertCalls(t)
+	})
+}
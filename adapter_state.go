@@ -0,0 +1,117 @@
+package zstack
+
+import (
+	"errors"
+	"fmt"
+)
+
+type AdapterState uint8
+
+const (
+	Uninitialised AdapterState = iota
+	Resetting
+	Configuring
+	Running
+	Stopped
+	Faulted
+)
+
+func (s AdapterState) String() string {
+	switch s {
+	case Uninitialised:
+		return "Uninitialised"
+	case Resetting:
+		return "Resetting"
+	case Configuring:
+		return "Configuring"
+	case Running:
+		return "Running"
+	case Stopped:
+		return "Stopped"
+	case Faulted:
+		return "Faulted"
+	default:
+		return fmt.Sprintf("Unknown(%d)", uint8(s))
+	}
+}
+
+var ErrAdapterNotReady = errors.New("adapter not ready")
+
+type AdapterStateChangeEvent struct {
+	Previous AdapterState
+	Current  AdapterState
+}
+
+func (z *ZStack) State() AdapterState {
+	z.stateLock.RLock()
+	defer z.stateLock.RUnlock()
+
+	return z.state
+}
+
+func (z *ZStack) setState(state AdapterState) AdapterState {
+	z.stateLock.Lock()
+	previous := z.state
+	z.state = state
+	z.stateLock.Unlock()
+
+	if previous != state {
+		/* State changes are reported without blocking, as Stop must not hang on a full event channel. */
+		z.trySendEvent(AdapterStateChangeEvent{Previous: previous, Current: state})
+	}
+
+	return previous
+}
+
+/* Changes state only if it has not been changed elsewhere, such as by Stop while background work was in progress. */
+func (z *ZStack) transitionState(from AdapterState, to AdapterState) bool {
+	z.stateLock.Lock()
+	if z.state != from {
+		z.stateLock.Unlock()
+		return false
+	}
+	z.state = to
+	z.stateLock.Unlock()
+
+	z.trySendEvent(AdapterStateChangeEvent{Previous: from, Current: to})
+	return true
+}
+
+func (z *ZStack) checkReady() error {
+	if state := z.State(); state != Running {
+		return fmt.Errorf("%w: state = %v", ErrAdapterNotReady, state)
+	}
+
+	return nil
+}
+
+func (z *ZStack) checkNotStopped() error {
+	if state := z.State(); state == Stopped {
+		return fmt.Errorf("%w: state = %v", ErrAdapterNotReady, state)
+	}
+
+	return nil
+}
+
+/* Checks the adapter is not in use, so that it may be reset without disrupting a running network. */
+func (z *ZStack) checkIdle() error {
+	if state := z.State(); state != Uninitialised && state != Faulted {
+		return fmt.Errorf("%w: state = %v", ErrAdapterNotReady, state)
+	}
+
+	return nil
+}
+
+func (z *ZStack) enterResetting() error {
+	if err := z.checkNotStopped(); err != nil {
+		return err
+	}
+
+	z.stopAdapterMonitor()
+	z.stopHealthCheck()
+	z.stopNetworkManager()
+	z.stopMessageReceiver()
+	z.setState(Resetting)
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_AdapterState(t *testing.T) {
+	t.Run("a new adapter is uninitialised", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		assert.Equal(t, Uninitialised, zstack.State())
+	})
+
+	t.Run("public methods return ErrAdapterNotReady before initialisation", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		err := zstack.SendApplicationMessageToNode(ctx, zigbee.IEEEAddress(1), zigbee.ApplicationMessage{}, false)
+		assert.ErrorIs(t, err, ErrAdapterNotReady)
+
+		err = zstack.PermitJoin(ctx, true)
+		assert.ErrorIs(t, err, ErrAdapterNotReady)
+
+		_, err = zstack.QueryNodeNWKAddress(ctx, zigbee.IEEEAddress(1))
+		assert.ErrorIs(t, err, ErrAdapterNotReady)
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("stop before initialisation does not block and emits a state change", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		assert.NoError(t, zstack.Stop(context.Background()))
+		assert.NoError(t, zstack.Stop(context.Background()))
+
+		assert.Equal(t, Stopped, zstack.State())
+
+		event, err := zstack.ReadEvent(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, AdapterStateChangeEvent{Previous: Uninitialised, Current: Stopped}, event)
+
+		_, err = zstack.ReadEvent(ctx)
+		assert.ErrorIs(t, err, ErrEventStreamClosed)
+	})
+
+	t.Run("initialise fails once the adapter is stopped", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		zstack.Stop(context.Background())
+
+		err := zstack.Initialise(ctx, zigbee.NetworkConfiguration{})
+		assert.ErrorIs(t, err, ErrAdapterNotReady)
+
+		unpiMock.AssertCalls(t)
+	})
+}
+
+func Test_AdapterStateString(t *testing.T) {
+	t.Run("entering resetting stops the network manager and message receiver", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		zstack.state = Running
+
+		managerCtx, managerCancel := context.WithCancel(context.Background())
+		zstack.networkManagerCancel = managerCancel
+
+		receiverStopped := false
+		zstack.messageReceiverStop = func() { receiverStopped = true }
+
+		err := zstack.enterResetting()
+		assert.NoError(t, err)
+
+		assert.Error(t, managerCtx.Err())
+		assert.True(t, receiverStopped)
+		assert.Equal(t, Resetting, zstack.State())
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("states have readable names", func(t *testing.T) {
+		assert.Equal(t, "Running", Running.String())
+		assert.Equal(t, "Faulted", Faulted.String())
+		assert.Equal(t, "Unknown(99)", AdapterState(99).String())
+	})
+}
@@ -0,0 +1,173 @@
+package zstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/zigbee"
+)
+
+var ErrPayloadTooLarge = errors.New("payload too large to send without APS fragmentation")
+var ErrFragmentationRequiresAck = errors.New("fragmented payloads must be sent with acknowledgement")
+
+/* Z-Stack accepts at most 250 bytes of payload in a single MT frame, less the fixed fields of each request. */
+const (
+	mtMaxPayload                = 250
+	afDataRequestInlineLimit    = mtMaxPayload - 10
+	afDataRequestExtInlineLimit = mtMaxPayload - 20
+	afDataStoreChunkSize        = mtMaxPayload - 3
+)
+
+type AfAddressMode uint8
+
+const (
+	AfAddressModeNotPresent AfAddressMode = 0x00
+	AfAddressModeGroup      AfAddressMode = 0x01
+	AfAddressMode16Bit      AfAddressMode = 0x02
+	AfAddressMode64Bit      AfAddressMode = 0x03
+	AfAddressModeBroadcast  AfAddressMode = 0x0f
+)
+
+/* Sends an extended data request without waiting for its AfDataConfirm, for use with group and broadcast addressing. */
+func (z *ZStack) sendDataRequestExt(ctx context.Context, request AfDataRequestExt) error {
+	if len(request.Data) > afDataRequestExtInlineLimit {
+		return fmt.Errorf("%w: length = %d", ErrPayloadTooLarge, len(request.Data))
+	}
+
+	transactionId, err := z.transactionPool.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	outcome := transactionAbandoned
+	defer func() { z.transactionPool.release(transactionId, outcome) }()
+
+	request.TransactionID = transactionId
+	reply := AfDataRequestExtReply{}
+
+	if err := z.requestResponder.RequestResponse(ctx, &request, &reply); err != nil {
+		return err
+	}
+
+	if !reply.WasSuccessful() {
+		outcome = transactionConfirmed
+		return ZStackStatusError{Err: ErrorZFailure, Status: reply.Status}
+	}
+
+	outcome = transactionUnacknowledged
+	return nil
+}
+
+type AfDataRequestExt struct {
+	DestinationAddressMode AfAddressMode
+	DestinationAddress     uint64
+	DestinationEndpoint    zigbee.Endpoint
+	DestinationPANID       zigbee.PANID
+	SourceEndpoint         zigbee.Endpoint
+	ClusterID              zigbee.ClusterID
+	TransactionID          uint8
+	Options                AfDataRequestOptions
+	Radius                 uint8
+	Data                   []byte `bcsliceprefix:"16"`
+}
+
+const AfDataRequestExtID uint8 = 0x02
+
+type AfDataRequestExtReply GenericZStackStatus
+
+func (s AfDataRequestExtReply) WasSuccessful() bool {
+	return s.Status == ZSuccess
+}
+
+const AfDataRequestExtReplyID uint8 = 0x02
+
+/*
+ * Payloads which do not fit in a single frame are declared to Z-Stack with an empty AfDataRequestExt, and then
+ * staged with AfDataStore. Z-Stack transmits the request when it receives an empty AfDataStore.
+ *
+ * Z-Stack holds a single staging buffer, so the staging slot is held from declaring the request until the final
+ * AfDataStore has been accepted, and not while waiting for the AfDataConfirm.
+ */
+func (z *ZStack) sendStagedDataRequestExt(ctx context.Context, request AfDataRequestExt) error {
+	select {
+	case z.dataStoreSlot <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("context expired while waiting to stage data request: %w", ctx.Err())
+	}
+	defer func() { <-z.dataStoreSlot }()
+
+	header := AfDataRequestExtStaged{
+		DestinationAddressMode: request.DestinationAddressMode,
+		DestinationAddress:     request.DestinationAddress,
+		DestinationEndpoint:    request.DestinationEndpoint,
+		DestinationPANID:       request.DestinationPANID,
+		SourceEndpoint:         request.SourceEndpoint,
+		ClusterID:              request.ClusterID,
+		TransactionID:          request.TransactionID,
+		Options:                request.Options,
+		Radius:                 request.Radius,
+		Length:                 uint16(len(request.Data)),
+	}
+
+	reply := AfDataRequestExtReply{}
+
+	if err := z.requestResponder.RequestResponse(ctx, &header, &reply); err != nil {
+		return err
+	}
+
+	if !reply.WasSuccessful() {
+		return ZStackStatusError{Err: ErrorZFailure, Status: reply.Status}
+	}
+
+	for index := 0; index < len(request.Data); index += afDataStoreChunkSize {
+		end := min(index+afDataStoreChunkSize, len(request.Data))
+
+		if err := z.storeData(ctx, AfDataStore{Index: uint16(index), Data: request.Data[index:end]}); err != nil {
+			return err
+		}
+	}
+
+	return z.storeData(ctx, AfDataStore{Index: uint16(len(request.Data))})
+}
+
+func (z *ZStack) storeData(ctx context.Context, store AfDataStore) error {
+	reply := AfDataStoreReply{}
+
+	if err := z.requestResponder.RequestResponse(ctx, &store, &reply); err != nil {
+		return fmt.Errorf("store: index = %d: %w", store.Index, err)
+	}
+
+	if !reply.WasSuccessful() {
+		return fmt.Errorf("store: index = %d: %w", store.Index, ZStackStatusError{Err: ErrorZFailure, Status: reply.Status})
+	}
+
+	return nil
+}
+
+type AfDataRequestExtStaged struct {
+	DestinationAddressMode AfAddressMode
+	DestinationAddress     uint64
+	DestinationEndpoint    zigbee.Endpoint
+	DestinationPANID       zigbee.PANID
+	SourceEndpoint         zigbee.Endpoint
+	ClusterID              zigbee.ClusterID
+	TransactionID          uint8
+	Options                AfDataRequestOptions
+	Radius                 uint8
+	Length                 uint16
+}
+
+type AfDataStore struct {
+	Index uint16
+	Data  []byte `bcsliceprefix:"8"`
+}
+
+const AfDataStoreID uint8 = 0x11
+
+type AfDataStoreReply GenericZStackStatus
+
+func (s AfDataStoreReply) WasSuccessful() bool {
+	return s.Status == ZSuccess
+}
+
+const AfDataStoreReplyID uint8 = 0x11
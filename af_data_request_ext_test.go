@@ -0,0 +1,83 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_AfDataRequestExtMessages(t *testing.T) {
+	t.Run("verify AfDataRequestExt marshals", func(t *testing.T) {
+		req := AfDataRequestExt{
+			DestinationAddressMode: AfAddressModeGroup,
+			DestinationAddress:     0x0102030405060708,
+			DestinationEndpoint:    0x09,
+			DestinationPANID:       0x0a0b,
+			SourceEndpoint:         0x0c,
+			ClusterID:              0x0d0e,
+			TransactionID:          0x0f,
+			Options:                AfDataRequestOptions{DiscoveryRoute: true},
+			Radius:                 0x10,
+			Data:                   []byte{0x11, 0x12},
+		}
+
+		data, err := bytecodec.Marshal(req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x01, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x09, 0x0b, 0x0a, 0x0c, 0x0e, 0x0d, 0x0f, 0x20, 0x10, 0x02, 0x00, 0x11, 0x12}, data)
+	})
+
+	t.Run("AfDataRequestExtReply returns true if success", func(t *testing.T) {
+		g := AfDataRequestExtReply{Status: ZSuccess}
+		assert.True(t, g.WasSuccessful())
+	})
+
+	t.Run("AfDataRequestExtReply returns false if not success", func(t *testing.T) {
+		g := AfDataRequestExtReply{Status: ZFailure}
+		assert.False(t, g.WasSuccessful())
+	})
+
+	t.Run("verify AfDataRequestExtStaged marshals", func(t *testing.T) {
+		req := AfDataRequestExtStaged{
+			DestinationAddressMode: AfAddressMode16Bit,
+			DestinationAddress:     0x0102,
+			DestinationEndpoint:    0x03,
+			DestinationPANID:       0x0405,
+			SourceEndpoint:         0x06,
+			ClusterID:              0x0708,
+			TransactionID:          0x09,
+			Radius:                 0x0a,
+			Length:                 0x0b0c,
+		}
+
+		data, err := bytecodec.Marshal(req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x02, 0x02, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0x05, 0x04, 0x06, 0x08, 0x07, 0x09, 0x00, 0x0a, 0x0c, 0x0b}, data)
+	})
+
+	t.Run("verify AfDataStore marshals", func(t *testing.T) {
+		req := AfDataStore{
+			Index: 0x0102,
+			Data:  []byte{0x03, 0x04},
+		}
+
+		data, err := bytecodec.Marshal(req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x02, 0x01, 0x02, 0x03, 0x04}, data)
+	})
+
+	t.Run("rejects group and broadcast payloads too large for a single frame", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		err := zstack.sendDataRequestExt(context.Background(), AfDataRequestExt{Data: make([]byte, afDataRequestExtInlineLimit+1)})
+		assert.ErrorIs(t, err, ErrPayloadTooLarge)
+	})
+}
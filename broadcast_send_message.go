@@ -0,0 +1,54 @@
+package zstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/zigbee"
+)
+
+var ErrNotBroadcastAddress = errors.New("destination is not a broadcast address")
+
+type BroadcastOptions struct {
+	Radius     uint8
+	APSOptions AfDataRequestOptions
+}
+
+func (z *ZStack) SendApplicationMessageToBroadcast(ctx context.Context, destination zigbee.NetworkAddress, message zigbee.ApplicationMessage, opts BroadcastOptions) error {
+	if err := z.checkReady(); err != nil {
+		return err
+	}
+
+	switch destination {
+	case zigbee.BroadcastAll, zigbee.BroadcastAlwaysOnReceivers, zigbee.BroadcastRoutersCoordinators, zigbee.BroadcastLowPowerRouters:
+	default:
+		return fmt.Errorf("%w: %v", ErrNotBroadcastAddress, destination)
+	}
+
+	radius := opts.Radius
+	if radius == 0 {
+		radius = z.config.radius
+	}
+
+	/* Broadcasts are never APS acknowledged, Z-Stack rejects the request if it is asked for. */
+	apsOptions := opts.APSOptions
+	apsOptions.ACKRequest = false
+
+	release, err := z.scheduler.acquire(ctx, PriorityInteractive, destination)
+	if err != nil {
+		return fmt.Errorf("failed to acquire request slot: %w", err)
+	}
+	defer release()
+
+	return z.sendDataRequestExt(ctx, AfDataRequestExt{
+		DestinationAddressMode: AfAddressModeBroadcast,
+		DestinationAddress:     uint64(destination),
+		DestinationEndpoint:    message.DestinationEndpoint,
+		DestinationPANID:       z.NetworkProperties.PANID,
+		SourceEndpoint:         message.SourceEndpoint,
+		ClusterID:              message.ClusterID,
+		Options:                apsOptions,
+		Radius:                 radius,
+		Data:                   message.Data,
+	})
+}
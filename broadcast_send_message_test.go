@@ -0,0 +1,86 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_SendApplicationMessageToBroadcast(t *testing.T) {
+	t.Run("sends broadcast addressed extended data request", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		zstack.NetworkProperties.PANID = 0x1234
+		defer unpiMock.Stop()
+
+		c := unpiMock.On(SREQ, AF, AfDataRequestExtID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestExtReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		appMessage := zigbee.ApplicationMessage{
+			ClusterID:           0x0006,
+			SourceEndpoint:      0x01,
+			DestinationEndpoint: 0xff,
+			Data:                []byte{0x0a, 0x0b},
+		}
+
+		err := zstack.SendApplicationMessageToBroadcast(ctx, zigbee.BroadcastAlwaysOnReceivers, appMessage, BroadcastOptions{
+			Radius:     0x05,
+			APSOptions: AfDataRequestOptions{EnableSecurity: true, ACKRequest: true},
+		})
+		assert.NoError(t, err)
+
+		sentFrame := c.CapturedCalls[0].Frame
+
+		assert.Equal(t, []byte{0x0f, 0xfd, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x34, 0x12, 0x01, 0x06, 0x00, 0x00, 0x40, 0x05, 0x02, 0x00, 0x0a, 0x0b}, sentFrame.Payload)
+	})
+
+	t.Run("uses the configured radius if none is provided", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New(), WithRadius(0x07))
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		c := unpiMock.On(SREQ, AF, AfDataRequestExtID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestExtReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		err := zstack.SendApplicationMessageToBroadcast(ctx, zigbee.BroadcastAll, zigbee.ApplicationMessage{}, BroadcastOptions{})
+		assert.NoError(t, err)
+
+		assert.Equal(t, uint8(0x07), c.CapturedCalls[0].Frame.Payload[17])
+	})
+
+	t.Run("rejects non broadcast destinations", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		err := zstack.SendApplicationMessageToBroadcast(context.Background(), zigbee.NetworkAddress(0x1000), zigbee.ApplicationMessage{}, BroadcastOptions{})
+		assert.ErrorIs(t, err, ErrNotBroadcastAddress)
+	})
+}
@@ -2,17 +2,220 @@ package zstack
 
 import (
 	"context"
+	"errors"
+	"github.com/shimmeringbee/zigbee"
+	"reflect"
+	"sync"
+	"sync/atomic"
 )
 
-func (z *ZStack) sendEvent(event interface{}) {
-	z.events <- event
+var ErrEventStreamClosed = errors.New("event stream closed")
+
+type OverflowPolicy uint8
+
+const (
+	OverflowBlock OverflowPolicy = iota
+	OverflowDropOldest
+	OverflowDropNewest
+)
+
+type EventFilter func(event interface{}) bool
+
+func FilterEventType(example interface{}) EventFilter {
+	exampleType := reflect.TypeOf(example)
+
+	return func(event interface{}) bool {
+		return reflect.TypeOf(event) == exampleType
+	}
 }
 
-func (z *ZStack) ReadEvent(ctx context.Context) (interface{}, error) {
+func FilterIncomingMessageCluster(clusterID zigbee.ClusterID) EventFilter {
+	return func(event interface{}) bool {
+		msg, ok := event.(zigbee.NodeIncomingMessageEvent)
+		return ok && msg.ApplicationMessage.ClusterID == clusterID
+	}
+}
+
+type EventSubscription struct {
+	bus *eventBus
+
+	events  chan interface{}
+	done    chan struct{}
+	policy  OverflowPolicy
+	filters []EventFilter
+
+	dropped   atomic.Uint64
+	closeOnce sync.Once
+	sendLock  sync.Mutex
+}
+
+func (s *EventSubscription) ReadEvent(ctx context.Context) (interface{}, error) {
 	select {
-	case event := <-z.events:
+	case event, ok := <-s.events:
+		if !ok {
+			return nil, ErrEventStreamClosed
+		}
+
 		return event, nil
 	case <-ctx.Done():
 		return nil, context.DeadlineExceeded
 	}
 }
+
+func (s *EventSubscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+func (s *EventSubscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+func (s *EventSubscription) matches(event interface{}) bool {
+	for _, filter := range s.filters {
+		if !filter(event) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *EventSubscription) deliver(ctx context.Context, event interface{}, mayBlock bool) {
+	if !s.matches(event) {
+		return
+	}
+
+	switch {
+	case s.policy == OverflowBlock && mayBlock:
+		select {
+		case s.events <- event:
+		case <-s.done:
+		case <-ctx.Done():
+		}
+	case s.policy == OverflowDropOldest:
+		s.sendLock.Lock()
+		defer s.sendLock.Unlock()
+
+		for {
+			select {
+			case s.events <- event:
+				return
+			default:
+			}
+
+			select {
+			case <-s.events:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.events <- event:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+type eventBus struct {
+	ctx context.Context
+
+	lock          sync.RWMutex
+	subscriptions []*EventSubscription
+	closed        bool
+}
+
+func newEventBus(ctx context.Context) *eventBus {
+	return &eventBus{ctx: ctx}
+}
+
+func (b *eventBus) subscribe(bufferSize int, policy OverflowPolicy, filters []EventFilter) *EventSubscription {
+	s := &EventSubscription{
+		bus:     b,
+		events:  make(chan interface{}, bufferSize),
+		done:    make(chan struct{}),
+		policy:  policy,
+		filters: filters,
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		s.closeOnce.Do(func() {
+			close(s.done)
+			close(s.events)
+		})
+	} else {
+		b.subscriptions = append(b.subscriptions, s)
+	}
+
+	return s
+}
+
+func (b *eventBus) unsubscribe(s *EventSubscription) {
+	/* Release any publisher blocked on this subscription before taking the write lock. */
+	s.closeOnce.Do(func() {
+		close(s.done)
+
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		for i, existing := range b.subscriptions {
+			if existing == s {
+				b.subscriptions = append(b.subscriptions[:i], b.subscriptions[i+1:]...)
+				break
+			}
+		}
+
+		close(s.events)
+	})
+}
+
+func (b *eventBus) publish(event interface{}, mayBlock bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for _, s := range b.subscriptions {
+		s.deliver(b.ctx, event, mayBlock)
+	}
+}
+
+func (b *eventBus) close() {
+	b.lock.RLock()
+	subscriptions := append([]*EventSubscription(nil), b.subscriptions...)
+	b.lock.RUnlock()
+
+	for _, s := range subscriptions {
+		b.unsubscribe(s)
+	}
+
+	b.lock.Lock()
+	b.closed = true
+	b.lock.Unlock()
+}
+
+func (z *ZStack) Subscribe(bufferSize int, policy OverflowPolicy, filters ...EventFilter) *EventSubscription {
+	return z.eventBus.subscribe(bufferSize, policy, filters)
+}
+
+func (z *ZStack) sendEvent(event interface{}) {
+	z.eventBus.publish(event, true)
+}
+
+func (z *ZStack) trySendEvent(event interface{}) {
+	z.eventBus.publish(event, false)
+}
+
+func (z *ZStack) closeEvents() {
+	z.eventBus.close()
+}
+
+func (z *ZStack) ReadEvent(ctx context.Context) (interface{}, error) {
+	return z.events.ReadEvent(ctx)
+}
+
+func (z *ZStack) DroppedEvents() uint64 {
+	return z.events.Dropped()
+}
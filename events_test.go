@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/shimmeringbee/persistence/impl/memory"
 	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -22,4 +23,136 @@ func Test_ReadEvent(t *testing.T) {
 		_, err := zstack.ReadEvent(ctx)
 		assert.Error(t, err)
 	})
+
+	t.Run("returns a terminal error once stopped and drained", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+		defer unpiMock.AssertCalls(t)
+
+		zstack.sendEvent("pending")
+
+		err := zstack.Stop(ctx)
+		assert.NoError(t, err)
+
+		event, err := zstack.ReadEvent(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "pending", event)
+
+		event, err = zstack.ReadEvent(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, AdapterStateChangeEvent{Previous: Uninitialised, Current: Stopped}, event)
+
+		_, err = zstack.ReadEvent(ctx)
+		assert.ErrorIs(t, err, ErrEventStreamClosed)
+
+		zstack.sendEvent("dropped")
+	})
+}
+
+func Test_Subscribe(t *testing.T) {
+	t.Run("delivers events to every subscriber", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		first := zstack.Subscribe(1, OverflowBlock)
+		second := zstack.Subscribe(1, OverflowBlock)
+
+		zstack.sendEvent("event")
+
+		event, err := first.ReadEvent(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "event", event)
+
+		event, err = second.ReadEvent(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "event", event)
+	})
+
+	t.Run("drop newest discards events once buffer is full", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		sub := zstack.Subscribe(1, OverflowDropNewest)
+
+		zstack.sendEvent("first")
+		zstack.sendEvent("second")
+
+		event, err := sub.ReadEvent(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "first", event)
+		assert.Equal(t, uint64(1), sub.Dropped())
+	})
+
+	t.Run("drop oldest discards queued events once buffer is full", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		sub := zstack.Subscribe(1, OverflowDropOldest)
+
+		zstack.sendEvent("first")
+		zstack.sendEvent("second")
+
+		event, err := sub.ReadEvent(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "second", event)
+		assert.Equal(t, uint64(1), sub.Dropped())
+	})
+
+	t.Run("a slow blocking subscriber is released when closed", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		sub := zstack.Subscribe(0, OverflowBlock)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			sub.Close()
+		}()
+
+		zstack.sendEvent("event")
+
+		_, err := sub.ReadEvent(context.Background())
+		assert.ErrorIs(t, err, ErrEventStreamClosed)
+	})
+
+	t.Run("filters events by type and cluster", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		sub := zstack.Subscribe(5, OverflowDropNewest, FilterEventType(zigbee.NodeIncomingMessageEvent{}), FilterIncomingMessageCluster(0x0006))
+
+		expected := zigbee.NodeIncomingMessageEvent{IncomingMessage: zigbee.IncomingMessage{ApplicationMessage: zigbee.ApplicationMessage{ClusterID: 0x0006}}}
+
+		zstack.sendEvent("unrelated")
+		zstack.sendEvent(zigbee.NodeIncomingMessageEvent{IncomingMessage: zigbee.IncomingMessage{ApplicationMessage: zigbee.ApplicationMessage{ClusterID: 0x0008}}})
+		zstack.sendEvent(expected)
+
+		event, err := sub.ReadEvent(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, event)
+
+		_, err = sub.ReadEvent(ctx)
+		assert.Error(t, err)
+	})
 }
@@ -12,7 +12,6 @@ require (
 	github.com/shimmeringbee/unpi v0.0.0-20240714070717-115f7e5e7d4a
 	github.com/shimmeringbee/zigbee v0.0.0-20240614104723-f4c0c0231568
 	github.com/stretchr/testify v1.9.0
-	golang.org/x/sync v0.7.0
 )
 
 require (
@@ -0,0 +1,30 @@
+package zstack
+
+import (
+	"context"
+	"fmt"
+	"github.com/shimmeringbee/zigbee"
+)
+
+func (z *ZStack) SendApplicationMessageToGroup(ctx context.Context, groupID zigbee.GroupID, message zigbee.ApplicationMessage) error {
+	if err := z.checkReady(); err != nil {
+		return err
+	}
+
+	release, err := z.scheduler.acquire(ctx, PriorityInteractive, zigbee.BroadcastAll)
+	if err != nil {
+		return fmt.Errorf("failed to acquire request slot: %w", err)
+	}
+	defer release()
+
+	return z.sendDataRequestExt(ctx, AfDataRequestExt{
+		DestinationAddressMode: AfAddressModeGroup,
+		DestinationAddress:     uint64(groupID),
+		DestinationEndpoint:    message.DestinationEndpoint,
+		DestinationPANID:       z.NetworkProperties.PANID,
+		SourceEndpoint:         message.SourceEndpoint,
+		ClusterID:              message.ClusterID,
+		Radius:                 z.config.radius,
+		Data:                   message.Data,
+	})
+}
@@ -0,0 +1,71 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_SendApplicationMessageToGroup(t *testing.T) {
+	t.Run("sends group addressed extended data request", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		zstack.NetworkProperties.PANID = 0x1234
+		defer unpiMock.Stop()
+
+		c := unpiMock.On(SREQ, AF, AfDataRequestExtID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestExtReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		appMessage := zigbee.ApplicationMessage{
+			ClusterID:           0x0006,
+			SourceEndpoint:      0x01,
+			DestinationEndpoint: 0xff,
+			Data:                []byte{0x0a, 0x0b},
+		}
+
+		err := zstack.SendApplicationMessageToGroup(ctx, zigbee.GroupID(0x4001), appMessage)
+		assert.NoError(t, err)
+
+		sentFrame := c.CapturedCalls[0].Frame
+
+		assert.Equal(t, []byte{0x01, 0x01, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x34, 0x12, 0x01, 0x06, 0x00, 0x00, 0x00, 0x20, 0x02, 0x00, 0x0a, 0x0b}, sentFrame.Payload)
+	})
+
+	t.Run("returns the status if the adapter rejects the request", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		unpiMock.On(SREQ, AF, AfDataRequestExtID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestExtReplyID,
+			Payload:     []byte{0x10},
+		})
+
+		err := zstack.SendApplicationMessageToGroup(ctx, zigbee.GroupID(0x4001), zigbee.ApplicationMessage{})
+		assert.ErrorIs(t, err, ErrorZFailure)
+		assert.ErrorIs(t, err, ZMemError)
+	})
+}
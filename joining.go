@@ -7,6 +7,10 @@ import (
 )
 
 func (z *ZStack) PermitJoin(ctx context.Context, allRouters bool) error {
+	if err := z.checkReady(); err != nil {
+		return err
+	}
+
 	if allRouters {
 		return z.sendJoin(ctx, zigbee.BroadcastRoutersCoordinators, JoiningOn, OnAllRouters)
 	} else {
@@ -15,14 +19,19 @@ func (z *ZStack) PermitJoin(ctx context.Context, allRouters bool) error {
 }
 
 func (z *ZStack) DenyJoin(ctx context.Context) error {
+	if err := z.checkReady(); err != nil {
+		return err
+	}
+
 	return z.sendJoin(ctx, zigbee.BroadcastRoutersCoordinators, JoiningOff, Off)
 }
 
 func (z *ZStack) sendJoin(ctx context.Context, address zigbee.NetworkAddress, timeout uint8, newState JoinState) error {
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		return fmt.Errorf("failed to acquire semaphore: %w", err)
+	release, err := z.scheduler.acquire(ctx, PriorityInteractive, address)
+	if err != nil {
+		return fmt.Errorf("failed to acquire request slot: %w", err)
 	}
-	defer z.sem.Release(1)
+	defer release()
 
 	response := ZDOMgmtPermitJoinRequestReply{}
 
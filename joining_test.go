@@ -8,7 +8,6 @@ import (
 	unpiTest "github.com/shimmeringbee/unpi/testing"
 	"github.com/shimmeringbee/zigbee"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/sync/semaphore"
 	"testing"
 	"time"
 )
@@ -20,7 +19,8 @@ func Test_PermitJoin(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		c := unpiMock.On(SREQ, ZDO, ZDOMgmtPermitJoinRequestID).Return(Frame{
@@ -45,7 +45,8 @@ func Test_PermitJoin(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 		zstack.NetworkProperties.NetworkAddress = zigbee.NetworkAddress(0x0102)
 
@@ -71,7 +72,8 @@ func Test_PermitJoin(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		unpiMock.On(SREQ, ZDO, ZDOMgmtPermitJoinRequestID).Return(Frame{
@@ -95,7 +97,8 @@ func Test_DenyJoin(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		c := unpiMock.On(SREQ, ZDO, ZDOMgmtPermitJoinRequestID).Return(Frame{
@@ -121,7 +124,8 @@ func Test_DenyJoin(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		unpiMock.On(SREQ, ZDO, ZDOMgmtPermitJoinRequestID).Return(Frame{
@@ -10,12 +10,30 @@ func registerMessages(l *Library) {
 	l.Add(AREQ, SYS, SysResetReqID, SysResetReq{})
 	l.Add(AREQ, SYS, SysResetIndID, SysResetInd{})
 
+	l.Add(SREQ, SYS, SysPingID, SysPing{})
+	l.Add(SRSP, SYS, SysPingReplyID, SysPingReply{})
+
 	l.Add(SREQ, SYS, SysOSALNVReadID, SysOSALNVRead{})
 	l.Add(SRSP, SYS, SysOSALNVReadReplyID, SysOSALNVReadReply{})
 
 	l.Add(SREQ, SYS, SysOSALNVWriteID, SysOSALNVWrite{})
 	l.Add(SRSP, SYS, SysOSALNVWriteReplyID, SysOSALNVWriteReply{})
 
+	l.Add(SREQ, SYS, SysOSALNVDeleteID, SysOSALNVDelete{})
+	l.Add(SRSP, SYS, SysOSALNVDeleteReplyID, SysOSALNVDeleteReply{})
+
+	l.Add(SREQ, SYS, SysOSALNVLengthID, SysOSALNVLength{})
+	l.Add(SRSP, SYS, SysOSALNVLengthReplyID, SysOSALNVLengthReply{})
+
+	l.Add(SREQ, SYS, SysNVCreateID, SysNVCreate{})
+	l.Add(SRSP, SYS, SysNVCreateReplyID, SysNVCreateReply{})
+
+	l.Add(SREQ, SYS, SysNVReadID, SysNVRead{})
+	l.Add(SRSP, SYS, SysNVReadReplyID, SysNVReadReply{})
+
+	l.Add(SREQ, SYS, SysNVWriteID, SysNVWrite{})
+	l.Add(SRSP, SYS, SysNVWriteReplyID, SysNVWriteReply{})
+
 	l.Add(AREQ, ZDO, ZDOStateChangeIndID, ZDOStateChangeInd{})
 
 	l.Add(AREQ, ZDO, ZdoEndDeviceAnnceIndID, ZdoEndDeviceAnnceInd{})
@@ -81,6 +99,38 @@ func registerMessages(l *Library) {
 	l.Add(SREQ, ZDO, ZdoMgmtLeaveReqID, ZdoMgmtLeaveReq{})
 	l.Add(SRSP, ZDO, ZdoMgmtLeaveReqReplyID, ZdoMgmtLeaveReqReply{})
 	l.Add(AREQ, ZDO, ZdoMgmtLeaveRspID, ZdoMgmtLeaveRsp{})
+
+	l.Add(SREQ, ZDO, ZdoMgmtNwkUpdateReqID, ZdoMgmtNwkUpdateReq{})
+	l.Add(SRSP, ZDO, ZdoMgmtNwkUpdateReqReplyID, ZdoMgmtNwkUpdateReqReply{})
+	l.Add(AREQ, ZDO, ZdoMgmtNwkUpdateNotifyID, ZdoMgmtNwkUpdateNotify{})
+
+	l.Add(SREQ, ZDO, ZdoExtNwkInfoID, ZdoExtNwkInfo{})
+	l.Add(SRSP, ZDO, ZdoExtNwkInfoReplyID, ZdoExtNwkInfoReply{})
+
+	l.Add(SREQ, ZDO, ZdoExtUpdateNwkKeyID, ZdoExtUpdateNwkKey{})
+	l.Add(SRSP, ZDO, ZdoExtUpdateNwkKeyReplyID, ZdoExtUpdateNwkKeyReply{})
+
+	l.Add(SREQ, ZDO, ZdoExtSwitchNwkKeyID, ZdoExtSwitchNwkKey{})
+	l.Add(SRSP, ZDO, ZdoExtSwitchNwkKeyReplyID, ZdoExtSwitchNwkKeyReply{})
+
+	l.Add(SREQ, ZDO, ZdoExtRouteDiscID, ZdoExtRouteDisc{})
+	l.Add(SRSP, ZDO, ZdoExtRouteDiscReplyID, ZdoExtRouteDiscReply{})
+
+	l.Add(SREQ, AF, AfDataRequestExtID, AfDataRequestExtStaged{})
+	l.Add(SREQ, AF, AfDataRequestExtID, AfDataRequestExt{})
+	l.Add(SRSP, AF, AfDataRequestExtReplyID, AfDataRequestExtReply{})
+
+	l.Add(SREQ, AF, AfDataStoreID, AfDataStore{})
+	l.Add(SRSP, AF, AfDataStoreReplyID, AfDataStoreReply{})
+
+	l.Add(SREQ, ZDO, ZdoExtAddGroupID, ZdoExtAddGroup{})
+	l.Add(SRSP, ZDO, ZdoExtAddGroupReplyID, ZdoExtAddGroupReply{})
+
+	l.Add(SREQ, ZDO, ZdoExtRemoveGroupID, ZdoExtRemoveGroup{})
+	l.Add(SRSP, ZDO, ZdoExtRemoveGroupReplyID, ZdoExtRemoveGroupReply{})
+
+	l.Add(SREQ, ZDO, ZdoExtFindGroupID, ZdoExtFindGroup{})
+	l.Add(SRSP, ZDO, ZdoExtFindGroupReplyID, ZdoExtFindGroupReply{})
 }
 
 type ZStackStatus uint8
@@ -98,8 +148,3 @@ func (s GenericZStackStatus) WasSuccessful() bool {
 }
 
 var ErrorZFailure = errors.New("ZStack has returned a failure")
-
-const (
-	ZSuccess ZStackStatus = 0x00
-	ZFailure ZStackStatus = 0x01
-)
@@ -0,0 +1,224 @@
+package zstack
+
+import (
+	"context"
+	"fmt"
+	"github.com/shimmeringbee/persistence"
+	"github.com/shimmeringbee/retry"
+	"github.com/shimmeringbee/zigbee"
+	"time"
+)
+
+const ChangeChannelScanDuration uint8 = 0xfe
+
+const channelChangePollInterval = 500 * time.Millisecond
+
+func (z *ZStack) ChangeChannel(ctx context.Context, channel uint8) error {
+	if err := z.checkReady(); err != nil {
+		return err
+	}
+
+	channelMask, err := channelsToMask([]uint8{channel})
+	if err != nil {
+		return err
+	}
+
+	if err := z.broadcastChannelChange(ctx, channelMask); err != nil {
+		return err
+	}
+
+	if err := z.waitForChannel(ctx, channel); err != nil {
+		return err
+	}
+
+	channelBits := channelToBits(channel)
+
+	steps := []func(context.Context) error{
+		func(invokeCtx context.Context) error {
+			return z.writeNVRAM(invokeCtx, ZCDNVChanList{Channels: channelBits})
+		},
+	}
+
+	if z.adapterVersion.IsV3() {
+		steps = append(steps, func(invokeCtx context.Context) error {
+			return z.requestResponder.RequestResponse(invokeCtx, APPCNFBDBSetChannelRequest{IsPrimary: true, Channel: channelBits}, &APPCNFBDBSetChannelRequestReply{})
+		})
+	}
+
+	if err := z.retryFunctions(ctx, steps); err != nil {
+		return err
+	}
+
+	z.NetworkProperties.Channel = channel
+	z.persistChannel(channel)
+
+	return nil
+}
+
+func (z *ZStack) selectChannelSteps() []configurationStep {
+	if !z.config.automaticChannel {
+		return nil
+	}
+
+	return []configurationStep{
+		{
+			description: "Move network to quietest channel.",
+			noRetry:     true,
+			invoke:      z.selectAutomaticChannel,
+		},
+	}
+}
+
+/*
+ZDO only performs energy scans once the network has been formed, so the quietest channel is chosen after forming and
+the network moved to it before any device has joined.
+*/
+func (z *ZStack) selectAutomaticChannel(ctx context.Context) error {
+	energies, err := z.ScanEnergy(ctx, z.config.permittedChannels, DefaultEnergyScanDuration)
+	if err != nil {
+		return err
+	}
+
+	channel := selectQuietestChannel(energies)
+
+	if channel == 0 || channel == z.NetworkProperties.Channel {
+		z.persistChannel(z.NetworkProperties.Channel)
+		return nil
+	}
+
+	return z.ChangeChannel(ctx, channel)
+}
+
+func selectQuietestChannel(energies map[uint8]uint8) uint8 {
+	if channel := quietestChannel(energies, zigbee.ZLLChannels); channel != 0 {
+		return channel
+	}
+
+	return quietestChannel(energies, zigbee.Channels)
+}
+
+func quietestChannel(energies map[uint8]uint8, candidates []uint8) uint8 {
+	var quietest uint8
+
+	for _, channel := range candidates {
+		energy, found := energies[channel]
+		if !found {
+			continue
+		}
+
+		if quietest == 0 || energy < energies[quietest] {
+			quietest = channel
+		}
+	}
+
+	return quietest
+}
+
+/* The persisted channel only applies to the network it was recorded for, so a new network is formed on the requested channel. */
+func (z *ZStack) persistedChannel(extendedPANID zigbee.ExtendedPANID) (uint8, bool) {
+	section := z.persistence.Section("Network")
+
+	channel, found := section.UInt("Channel")
+	if !found {
+		return 0, false
+	}
+
+	if persistedPANID, found := section.UInt("ExtendedPANID"); found && zigbee.ExtendedPANID(persistedPANID) != extendedPANID {
+		return 0, false
+	}
+
+	return uint8(channel), true
+}
+
+func (z *ZStack) persistChannel(channel uint8) {
+	z.networkSection().Set("Channel", uint64(channel))
+}
+
+/* Returns the persisted network state for the current network, discarding anything recorded for a previous network. */
+func (z *ZStack) networkSection() persistence.Section {
+	section := z.persistence.Section("Network")
+
+	if persistedPANID, found := section.UInt("ExtendedPANID"); found && zigbee.ExtendedPANID(persistedPANID) != z.NetworkProperties.ExtendedPANID {
+		for _, key := range section.Keys() {
+			section.Delete(key)
+		}
+	}
+
+	section.Set("ExtendedPANID", uint64(z.NetworkProperties.ExtendedPANID))
+	return section
+}
+
+/* Channel changes made while running are persisted, and take precedence over the channel the caller configured. */
+func (z *ZStack) withPersistedChannel(nc zigbee.NetworkConfiguration) zigbee.NetworkConfiguration {
+	if channel, found := z.persistedChannel(nc.ExtendedPANID); found {
+		nc.Channel = channel
+	}
+
+	return nc
+}
+
+func (z *ZStack) broadcastChannelChange(ctx context.Context, channelMask uint32) error {
+	release, err := z.scheduler.acquire(ctx, PriorityInteractive, zigbee.BroadcastAll)
+	if err != nil {
+		return fmt.Errorf("failed to acquire request slot: %w", err)
+	}
+	defer release()
+
+	request := ZdoMgmtNwkUpdateReq{
+		DestinationAddress:    zigbee.NetworkAddress(0xffff),
+		DestinationAddrMode:   MgmtNwkUpdateAddrModeBroadcast,
+		ChannelMask:           channelMask,
+		ScanDuration:          ChangeChannelScanDuration,
+		NetworkManagerAddress: z.NetworkProperties.NetworkAddress,
+	}
+
+	return retry.Retry(ctx, z.config.timeout, z.config.retries, func(invokeCtx context.Context) error {
+		reply := ZdoMgmtNwkUpdateReqReply{}
+
+		if err := z.requestResponder.RequestResponse(invokeCtx, request, &reply); err != nil {
+			return err
+		}
+
+		if !reply.WasSuccessful() {
+			return ErrorZFailure
+		}
+
+		return nil
+	})
+}
+
+func (z *ZStack) waitForChannel(ctx context.Context, channel uint8) error {
+	for {
+		info := ZdoExtNwkInfoReply{}
+
+		if err := z.requestResponder.RequestResponse(ctx, ZdoExtNwkInfo{}, &info); err != nil {
+			return err
+		}
+
+		if info.Channel == channel {
+			return nil
+		}
+
+		select {
+		case <-time.After(channelChangePollInterval):
+		case <-ctx.Done():
+			return fmt.Errorf("context expired while waiting for adapter to change channel: %w", ctx.Err())
+		}
+	}
+}
+
+type ZdoExtNwkInfo struct{}
+
+const ZdoExtNwkInfoID uint8 = 0x50
+
+type ZdoExtNwkInfoReply struct {
+	NetworkAddress       zigbee.NetworkAddress
+	DeviceState          ZDOState
+	PANID                zigbee.PANID
+	ParentNetworkAddress zigbee.NetworkAddress
+	ExtendedPANID        zigbee.ExtendedPANID
+	ParentIEEEAddress    zigbee.IEEEAddress
+	Channel              uint8
+}
+
+const ZdoExtNwkInfoReplyID uint8 = 0x50
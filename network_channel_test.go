@@ -0,0 +1,325 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestZStack_ChangeChannel(t *testing.T) {
+	t.Run("broadcasts channel change, waits for the coordinator to move and persists the channel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		zstack.adapterVersion = Version{ProductID: 1}
+		zstack.NetworkProperties.Channel = 15
+		defer unpiMock.Stop()
+
+		updateCall := unpiMock.On(SREQ, ZDO, ZdoMgmtNwkUpdateReqID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoMgmtNwkUpdateReqReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		oldChannel, _ := bytecodec.Marshal(ZdoExtNwkInfoReply{Channel: 15})
+		newChannel, _ := bytecodec.Marshal(ZdoExtNwkInfoReply{Channel: 20})
+
+		unpiMock.On(SREQ, ZDO, ZdoExtNwkInfoID).Return(
+			Frame{MessageType: SRSP, Subsystem: ZDO, CommandID: ZdoExtNwkInfoReplyID, Payload: oldChannel},
+			Frame{MessageType: SRSP, Subsystem: ZDO, CommandID: ZdoExtNwkInfoReplyID, Payload: newChannel},
+		).Times(2)
+
+		nvramWriteResponse, _ := bytecodec.Marshal(SysOSALNVWriteReply{Status: ZSuccess})
+		nvramCall := unpiMock.On(SREQ, SYS, SysOSALNVWriteID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysOSALNVWriteReplyID,
+			Payload:     nvramWriteResponse,
+		})
+
+		bdbCall := unpiMock.On(SREQ, APP_CNF, APPCNFBDBSetChannelRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   APP_CNF,
+			CommandID:   APPCNFBDBSetChannelRequestReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		err := zstack.ChangeChannel(ctx, 20)
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(20), zstack.NetworkProperties.Channel)
+
+		persisted, found := zstack.persistedChannel(zstack.NetworkProperties.ExtendedPANID)
+		assert.True(t, found)
+		assert.Equal(t, uint8(20), persisted)
+
+		request := ZdoMgmtNwkUpdateReq{}
+		bytecodec.Unmarshal(updateCall.CapturedCalls[0].Frame.Payload, &request)
+
+		assert.Equal(t, zigbee.NetworkAddress(0xffff), request.DestinationAddress)
+		assert.Equal(t, MgmtNwkUpdateAddrModeBroadcast, request.DestinationAddrMode)
+		assert.Equal(t, uint32(1<<20), request.ChannelMask)
+		assert.Equal(t, ChangeChannelScanDuration, request.ScanDuration)
+
+		write := SysOSALNVWrite{}
+		bytecodec.Unmarshal(nvramCall.CapturedCalls[0].Frame.Payload, &write)
+		assert.Equal(t, ZCDNVChanListID, write.NVItemID)
+		assert.Equal(t, []byte{0x00, 0x00, 0x10, 0x00}, write.Value)
+
+		bdb := APPCNFBDBSetChannelRequest{}
+		bytecodec.Unmarshal(bdbCall.CapturedCalls[0].Frame.Payload, &bdb)
+		assert.True(t, bdb.IsPrimary)
+		assert.Equal(t, channelToBits(20), bdb.Channel)
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("returns an error if an invalid channel is requested", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		err := zstack.ChangeChannel(ctx, 27)
+		assert.Error(t, err)
+
+		unpiMock.AssertCalls(t)
+	})
+}
+
+func TestZStack_selectAutomaticChannel(t *testing.T) {
+	t.Run("persists the current channel if it is already the quietest", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New(), WithAutomaticChannelSelection(11, 15, 20))
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		zstack.NetworkProperties.Channel = 15
+		defer unpiMock.Stop()
+
+		call := unpiMock.On(SREQ, ZDO, ZdoMgmtNwkUpdateReqID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoMgmtNwkUpdateReqReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		notify, _ := bytecodec.Marshal(ZdoMgmtNwkUpdateNotify{
+			Status:          ZSuccess,
+			ScannedChannels: 1<<11 | 1<<15 | 1<<20,
+			EnergyValues:    []uint8{0x80, 0x10, 0x20},
+		})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   ZDO,
+				CommandID:   ZdoMgmtNwkUpdateNotifyID,
+				Payload:     notify,
+			})
+		}()
+
+		err := zstack.selectAutomaticChannel(ctx)
+		assert.NoError(t, err)
+
+		request := ZdoMgmtNwkUpdateReq{}
+		bytecodec.Unmarshal(call.CapturedCalls[0].Frame.Payload, &request)
+		assert.Equal(t, uint32(1<<11|1<<15|1<<20), request.ChannelMask)
+
+		persisted, found := zstack.persistedChannel(zstack.NetworkProperties.ExtendedPANID)
+		assert.True(t, found)
+		assert.Equal(t, uint8(15), persisted)
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("moves the formed network to the quietest channel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New(), WithAutomaticChannelSelection(11, 15, 20))
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		zstack.NetworkProperties.Channel = 11
+		defer unpiMock.Stop()
+
+		updateCall := unpiMock.On(SREQ, ZDO, ZdoMgmtNwkUpdateReqID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoMgmtNwkUpdateReqReplyID,
+			Payload:     []byte{0x00},
+		}).Times(2)
+
+		notify, _ := bytecodec.Marshal(ZdoMgmtNwkUpdateNotify{
+			Status:          ZSuccess,
+			ScannedChannels: 1<<11 | 1<<15 | 1<<20,
+			EnergyValues:    []uint8{0x80, 0x10, 0x20},
+		})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   ZDO,
+				CommandID:   ZdoMgmtNwkUpdateNotifyID,
+				Payload:     notify,
+			})
+		}()
+
+		newChannel, _ := bytecodec.Marshal(ZdoExtNwkInfoReply{Channel: 15})
+		unpiMock.On(SREQ, ZDO, ZdoExtNwkInfoID).Return(Frame{MessageType: SRSP, Subsystem: ZDO, CommandID: ZdoExtNwkInfoReplyID, Payload: newChannel})
+
+		nvramWriteResponse, _ := bytecodec.Marshal(SysOSALNVWriteReply{Status: ZSuccess})
+		unpiMock.On(SREQ, SYS, SysOSALNVWriteID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysOSALNVWriteReplyID,
+			Payload:     nvramWriteResponse,
+		})
+
+		err := zstack.selectAutomaticChannel(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(15), zstack.NetworkProperties.Channel)
+
+		change := ZdoMgmtNwkUpdateReq{}
+		bytecodec.Unmarshal(updateCall.CapturedCalls[1].Frame.Payload, &change)
+		assert.Equal(t, uint32(1<<15), change.ChannelMask)
+
+		persisted, found := zstack.persistedChannel(zstack.NetworkProperties.ExtendedPANID)
+		assert.True(t, found)
+		assert.Equal(t, uint8(15), persisted)
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("returns an error if the energy scan fails", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New(), WithTimeout(20*time.Millisecond), WithAutomaticChannelSelection(11, 15, 20))
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		zstack.NetworkProperties.Channel = 11
+		defer unpiMock.Stop()
+
+		unpiMock.On(SREQ, ZDO, ZdoMgmtNwkUpdateReqID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoMgmtNwkUpdateReqReplyID,
+			Payload:     []byte{0x01},
+		}).UnlimitedTimes()
+
+		err := zstack.selectAutomaticChannel(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, uint8(11), zstack.NetworkProperties.Channel)
+	})
+
+	t.Run("channel selection runs once a newly formed network has started", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New(), WithAutomaticChannelSelection())
+		defer unpiMock.Stop()
+
+		var descriptions []string
+		for _, step := range zstack.initialiseSteps(Version{ProductID: 1}, NetworkConfigVerification{Mismatches: []NetworkConfigMismatch{{Item: "ZCDNVChanList"}}}) {
+			descriptions = append(descriptions, step.description)
+		}
+
+		assert.Equal(t, "Move network to quietest channel.", descriptions[len(descriptions)-1])
+		assert.Less(t, slices.Index(descriptions, "Start Zigbee stack."), len(descriptions)-1)
+
+		descriptions = nil
+		for _, step := range zstack.initialiseSteps(Version{ProductID: 1}, NetworkConfigVerification{}) {
+			descriptions = append(descriptions, step.description)
+		}
+
+		assert.NotContains(t, descriptions, "Move network to quietest channel.")
+	})
+}
+
+func TestZStack_withPersistedChannel(t *testing.T) {
+	nc := zigbee.NetworkConfiguration{ExtendedPANID: 0x0102030405060708, Channel: 15}
+
+	t.Run("uses the requested channel if none has been persisted", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		assert.Equal(t, nc, zstack.withPersistedChannel(nc))
+	})
+
+	t.Run("uses a channel persisted for the same network without automatic channel selection", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		zstack.NetworkProperties.ExtendedPANID = nc.ExtendedPANID
+		zstack.persistChannel(20)
+
+		assert.Equal(t, uint8(20), zstack.withPersistedChannel(nc).Channel)
+	})
+
+	t.Run("ignores a channel persisted for a different network", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		zstack.NetworkProperties.ExtendedPANID = 0x1112131415161718
+		zstack.persistChannel(20)
+
+		assert.Equal(t, uint8(15), zstack.withPersistedChannel(nc).Channel)
+	})
+}
+
+func Test_selectQuietestChannel(t *testing.T) {
+	t.Run("prefers the quietest recommended channel", func(t *testing.T) {
+		energies := map[uint8]uint8{11: 0x40, 12: 0x01, 15: 0x30, 20: 0x20, 25: 0x50}
+		assert.Equal(t, uint8(20), selectQuietestChannel(energies))
+	})
+
+	t.Run("falls back to the quietest channel if no recommended channels were scanned", func(t *testing.T) {
+		energies := map[uint8]uint8{12: 0x40, 13: 0x10, 14: 0x30}
+		assert.Equal(t, uint8(13), selectQuietestChannel(energies))
+	})
+
+	t.Run("returns zero if no channels were scanned", func(t *testing.T) {
+		assert.Equal(t, uint8(0), selectQuietestChannel(map[uint8]uint8{}))
+	})
+}
+
+func Test_ZdoExtNwkInfoStructs(t *testing.T) {
+	t.Run("ZdoExtNwkInfoReply", func(t *testing.T) {
+		s := ZdoExtNwkInfoReply{
+			NetworkAddress:       0x0102,
+			DeviceState:          DeviceZBCoordinator,
+			PANID:                0x0304,
+			ParentNetworkAddress: 0x0506,
+			ExtendedPANID:        0x1112131415161718,
+			ParentIEEEAddress:    0x2122232425262728,
+			Channel:              20,
+		}
+
+		actualBytes, err := bytecodec.Marshal(s)
+
+		expectedBytes := []byte{0x02, 0x01, 0x09, 0x04, 0x03, 0x06, 0x05, 0x18, 0x17, 0x16, 0x15, 0x14, 0x13, 0x12, 0x11, 0x28, 0x27, 0x26, 0x25, 0x24, 0x23, 0x22, 0x21, 0x14}
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedBytes, actualBytes)
+	})
+}
@@ -0,0 +1,138 @@
+package zstack
+
+import (
+	"context"
+	"fmt"
+	"github.com/shimmeringbee/retry"
+	"github.com/shimmeringbee/zigbee"
+	"time"
+)
+
+const DefaultNetworkKeySwitchDelay = 10 * time.Second
+
+func (z *ZStack) RotateNetworkKey(ctx context.Context, newKey zigbee.NetworkKey) error {
+	if err := z.checkReady(); err != nil {
+		return err
+	}
+
+	activeKey := ZCDNVNwkActiveKeyInfo{}
+
+	if err := z.retryFunctions(ctx, []func(context.Context) error{
+		func(invokeCtx context.Context) error {
+			return z.readNVRAM(invokeCtx, &activeKey)
+		},
+	}); err != nil {
+		return err
+	}
+
+	keySeqNum := activeKey.KeySeqNum + 1
+
+	z.logger.LogInfo(ctx, "Distributing new network key.")
+	if err := z.broadcastNetworkKeyRequest(ctx, ZdoExtUpdateNwkKey{DestinationAddress: zigbee.NetworkAddress(0xffff), KeySeqNum: keySeqNum, Key: newKey}, &ZdoExtUpdateNwkKeyReply{}); err != nil {
+		return err
+	}
+
+	select {
+	case <-time.After(z.networkKeySwitchDelay):
+	case <-ctx.Done():
+		return fmt.Errorf("context expired while waiting for network key distribution: %w", ctx.Err())
+	}
+
+	z.logger.LogInfo(ctx, "Switching to new network key.")
+	if err := z.broadcastNetworkKeyRequest(ctx, ZdoExtSwitchNwkKey{DestinationAddress: zigbee.NetworkAddress(0xffff), KeySeqNum: keySeqNum}, &ZdoExtSwitchNwkKeyReply{}); err != nil {
+		return err
+	}
+
+	if err := z.retryFunctions(ctx, []func(context.Context) error{
+		func(invokeCtx context.Context) error {
+			return z.writeNVRAM(invokeCtx, ZCDNVPreCfgKey{NetworkKey: newKey})
+		},
+	}); err != nil {
+		return err
+	}
+
+	z.NetworkProperties.NetworkKey = newKey
+	z.persistNetworkKey(newKey)
+
+	return nil
+}
+
+/* The persisted network key only applies to the network it was rotated on, so a new network is formed with the requested key. */
+func (z *ZStack) persistedNetworkKey(extendedPANID zigbee.ExtendedPANID) (zigbee.NetworkKey, bool) {
+	section := z.persistence.Section("Network")
+
+	if persistedPANID, found := section.UInt("ExtendedPANID"); !found || zigbee.ExtendedPANID(persistedPANID) != extendedPANID {
+		return zigbee.NetworkKey{}, false
+	}
+
+	key, found := section.Bytes("NetworkKey")
+	if !found || len(key) != len(zigbee.NetworkKey{}) {
+		return zigbee.NetworkKey{}, false
+	}
+
+	return zigbee.NetworkKey(key), true
+}
+
+func (z *ZStack) persistNetworkKey(key zigbee.NetworkKey) {
+	z.networkSection().Set("NetworkKey", key[:])
+}
+
+/* Rotated network keys are persisted, and take precedence over the key the caller configured. */
+func (z *ZStack) withPersistedNetworkKey(nc zigbee.NetworkConfiguration) zigbee.NetworkConfiguration {
+	if key, found := z.persistedNetworkKey(nc.ExtendedPANID); found {
+		nc.NetworkKey = key
+	}
+
+	return nc
+}
+
+func (z *ZStack) broadcastNetworkKeyRequest(ctx context.Context, request interface{}, reply Successor) error {
+	release, err := z.scheduler.acquire(ctx, PriorityInteractive, zigbee.BroadcastAll)
+	if err != nil {
+		return fmt.Errorf("failed to acquire request slot: %w", err)
+	}
+	defer release()
+
+	return retry.Retry(ctx, z.config.timeout, z.config.retries, func(invokeCtx context.Context) error {
+		if err := z.requestResponder.RequestResponse(invokeCtx, request, reply); err != nil {
+			return err
+		}
+
+		if !reply.WasSuccessful() {
+			return ErrorZFailure
+		}
+
+		return nil
+	})
+}
+
+type ZdoExtUpdateNwkKey struct {
+	DestinationAddress zigbee.NetworkAddress
+	KeySeqNum          uint8
+	Key                zigbee.NetworkKey
+}
+
+const ZdoExtUpdateNwkKeyID uint8 = 0x4e
+
+type ZdoExtUpdateNwkKeyReply GenericZStackStatus
+
+func (r ZdoExtUpdateNwkKeyReply) WasSuccessful() bool {
+	return r.Status == ZSuccess
+}
+
+const ZdoExtUpdateNwkKeyReplyID uint8 = 0x4e
+
+type ZdoExtSwitchNwkKey struct {
+	DestinationAddress zigbee.NetworkAddress
+	KeySeqNum          uint8
+}
+
+const ZdoExtSwitchNwkKeyID uint8 = 0x4f
+
+type ZdoExtSwitchNwkKeyReply GenericZStackStatus
+
+func (r ZdoExtSwitchNwkKeyReply) WasSuccessful() bool {
+	return r.Status == ZSuccess
+}
+
+const ZdoExtSwitchNwkKeyReplyID uint8 = 0x4f
@@ -0,0 +1,249 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestZStack_RotateNetworkKey(t *testing.T) {
+	t.Run("distributes the new key, switches to it and persists it", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		zstack.networkKeySwitchDelay = 10 * time.Millisecond
+		defer unpiMock.Stop()
+
+		newKey := zigbee.NetworkKey{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+
+		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(nvramReadFrame(ZCDNVNwkActiveKeyInfo{KeySeqNum: 4})).Times(1)
+
+		updateCall := unpiMock.On(SREQ, ZDO, ZdoExtUpdateNwkKeyID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoExtUpdateNwkKeyReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		switchCall := unpiMock.On(SREQ, ZDO, ZdoExtSwitchNwkKeyID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoExtSwitchNwkKeyReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		nvramWriteResponse, _ := bytecodec.Marshal(SysOSALNVWriteReply{Status: ZSuccess})
+		nvramCall := unpiMock.On(SREQ, SYS, SysOSALNVWriteID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   SYS,
+			CommandID:   SysOSALNVWriteReplyID,
+			Payload:     nvramWriteResponse,
+		})
+
+		err := zstack.RotateNetworkKey(ctx, newKey)
+		assert.NoError(t, err)
+		assert.Equal(t, newKey, zstack.NetworkProperties.NetworkKey)
+
+		persistedKey, found := zstack.persistedNetworkKey(zstack.NetworkProperties.ExtendedPANID)
+		assert.True(t, found)
+		assert.Equal(t, newKey, persistedKey)
+
+		update := ZdoExtUpdateNwkKey{}
+		bytecodec.Unmarshal(updateCall.CapturedCalls[0].Frame.Payload, &update)
+		assert.Equal(t, zigbee.NetworkAddress(0xffff), update.DestinationAddress)
+		assert.Equal(t, uint8(5), update.KeySeqNum)
+		assert.Equal(t, newKey, update.Key)
+
+		switchReq := ZdoExtSwitchNwkKey{}
+		bytecodec.Unmarshal(switchCall.CapturedCalls[0].Frame.Payload, &switchReq)
+		assert.Equal(t, zigbee.NetworkAddress(0xffff), switchReq.DestinationAddress)
+		assert.Equal(t, uint8(5), switchReq.KeySeqNum)
+
+		write := SysOSALNVWrite{}
+		bytecodec.Unmarshal(nvramCall.CapturedCalls[0].Frame.Payload, &write)
+		assert.Equal(t, ZCDNVPreCfgKeyID, write.NVItemID)
+		assert.Equal(t, newKey[:], write.Value)
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("does not switch key if distribution fails", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		zstack.networkKeySwitchDelay = 10 * time.Millisecond
+		defer unpiMock.Stop()
+
+		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(nvramReadFrame(ZCDNVNwkActiveKeyInfo{KeySeqNum: 4})).Times(1)
+
+		unpiMock.On(SREQ, ZDO, ZdoExtUpdateNwkKeyID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoExtUpdateNwkKeyReplyID,
+			Payload:     []byte{0x01},
+		}).Times(DefaultZStackRetries)
+
+		err := zstack.RotateNetworkKey(ctx, zigbee.NetworkKey{0x01})
+		assert.Error(t, err)
+		assert.Equal(t, zigbee.NetworkKey{}, zstack.NetworkProperties.NetworkKey)
+
+		unpiMock.AssertCalls(t)
+	})
+}
+
+func TestZStack_RotateNetworkKey_Initialise(t *testing.T) {
+	t.Run("initialising with the original configuration after a rotation does not wipe the adapter", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		p := memory.New()
+
+		nc := zigbee.NetworkConfiguration{
+			PANID:         zigbee.PANID(0x0102),
+			ExtendedPANID: zigbee.ExtendedPANID(0x0102030405060708),
+			NetworkKey:    zigbee.NetworkKey{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			Channel:       zigbee.DefaultChannel,
+		}
+
+		newKey := zigbee.NetworkKey{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+
+		rotateMock := unpiTest.NewMockAdapter()
+		rotating := New(rotateMock, p)
+		rotating.scheduler.setCapacity(8)
+		rotating.state = Running
+		rotating.networkKeySwitchDelay = 10 * time.Millisecond
+		rotating.NetworkProperties.ExtendedPANID = nc.ExtendedPANID
+		defer rotateMock.Stop()
+
+		rotateMock.On(SREQ, SYS, SysOSALNVReadID).Return(nvramReadFrame(ZCDNVNwkActiveKeyInfo{KeySeqNum: 4}))
+		rotateMock.On(SREQ, ZDO, ZdoExtUpdateNwkKeyID).Return(Frame{MessageType: SRSP, Subsystem: ZDO, CommandID: ZdoExtUpdateNwkKeyReplyID, Payload: []byte{0x00}})
+		rotateMock.On(SREQ, ZDO, ZdoExtSwitchNwkKeyID).Return(Frame{MessageType: SRSP, Subsystem: ZDO, CommandID: ZdoExtSwitchNwkKeyReplyID, Payload: []byte{0x00}})
+
+		nvramWriteResponse, _ := bytecodec.Marshal(SysOSALNVWriteReply{Status: ZSuccess})
+		rotateMock.On(SREQ, SYS, SysOSALNVWriteID).Return(Frame{MessageType: SRSP, Subsystem: SYS, CommandID: SysOSALNVWriteReplyID, Payload: nvramWriteResponse})
+
+		assert.NoError(t, rotating.RotateNetworkKey(ctx, newKey))
+		rotateMock.AssertCalls(t)
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, p)
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		resetResponse, _ := bytecodec.Marshal(SysResetInd{Reason: External, Version: Version{}})
+		unpiMock.On(AREQ, SYS, SysResetReqID).Return(Frame{MessageType: AREQ, Subsystem: SYS, CommandID: SysResetIndID, Payload: resetResponse}).Times(1)
+
+		unpiMock.On(SREQ, SYS, SysOSALNVReadID).Return(
+			nvramReadFrame(ZCDNVLogicalType{LogicalType: zigbee.Coordinator}),
+			nvramReadFrame(ZCDNVPANID{PANID: nc.PANID}),
+			nvramReadFrame(ZCDNVExtPANID{ExtendedPANID: nc.ExtendedPANID}),
+			nvramReadFrame(ZCDNVChanList{Channels: channelToBits(nc.Channel)}),
+			nvramReadFrame(ZCDNVPreCfgKeysEnable{Enabled: 1}),
+			nvramReadFrame(ZCDNVPreCfgKey{NetworkKey: newKey}),
+		).Times(6)
+
+		unpiMock.On(SREQ, ZDO, ZDOStartUpFromAppRequestId).Return(Frame{MessageType: SRSP, Subsystem: ZDO, CommandID: ZDOStartUpFromAppRequestReplyID, Payload: []byte{0x00}})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			unpiMock.InjectOutgoing(Frame{MessageType: AREQ, Subsystem: ZDO, CommandID: ZDOStateChangeIndID, Payload: []byte{0x09}})
+		}()
+
+		unpiMock.On(SREQ, UTIL, UtilGetDeviceInfoRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   UTIL,
+			CommandID:   UtilGetDeviceInfoRequestReplyID,
+			Payload:     []byte{0x00, 0x0f, 0x0e, 0x0d, 0x0c, 0x0b, 0x0a, 0x09, 0x08, 0x09, 0x08},
+		}).Times(2)
+
+		unpiMock.On(SREQ, ZDO, ZDOMgmtPermitJoinRequestID).Return(Frame{MessageType: SRSP, Subsystem: ZDO, CommandID: ZDOMgmtPermitJoinRequestReplyID, Payload: []byte{0x00}})
+
+		assert.NoError(t, zstack.Initialise(ctx, nc))
+		assert.Equal(t, Running, zstack.State())
+		assert.Equal(t, newKey, zstack.NetworkProperties.NetworkKey)
+
+		unpiMock.AssertCalls(t)
+	})
+}
+
+func TestZStack_withPersistedNetworkKey(t *testing.T) {
+	nc := zigbee.NetworkConfiguration{ExtendedPANID: 0x0102030405060708, NetworkKey: zigbee.NetworkKey{0x01}}
+
+	t.Run("uses the requested key if none has been persisted", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		assert.Equal(t, nc, zstack.withPersistedNetworkKey(nc))
+	})
+
+	t.Run("ignores a key persisted for a different network", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		zstack.NetworkProperties.ExtendedPANID = 0x1112131415161718
+		zstack.persistNetworkKey(zigbee.NetworkKey{0x02})
+
+		assert.Equal(t, nc.NetworkKey, zstack.withPersistedNetworkKey(nc).NetworkKey)
+	})
+
+	t.Run("discards a key persisted for a previous network when persisting for a new one", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		zstack.NetworkProperties.ExtendedPANID = 0x1112131415161718
+		zstack.persistNetworkKey(zigbee.NetworkKey{0x02})
+
+		zstack.NetworkProperties.ExtendedPANID = nc.ExtendedPANID
+		zstack.persistChannel(20)
+
+		assert.Equal(t, nc.NetworkKey, zstack.withPersistedNetworkKey(nc).NetworkKey)
+	})
+}
+
+func Test_ZdoExtNwkKeyStructs(t *testing.T) {
+	t.Run("ZdoExtUpdateNwkKey", func(t *testing.T) {
+		s := ZdoExtUpdateNwkKey{
+			DestinationAddress: 0x0102,
+			KeySeqNum:          0x03,
+			Key:                zigbee.NetworkKey{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+		}
+
+		actualBytes, err := bytecodec.Marshal(s)
+
+		expectedBytes := []byte{0x02, 0x01, 0x03, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedBytes, actualBytes)
+	})
+
+	t.Run("ZdoExtSwitchNwkKey", func(t *testing.T) {
+		s := ZdoExtSwitchNwkKey{
+			DestinationAddress: 0x0102,
+			KeySeqNum:          0x03,
+		}
+
+		actualBytes, err := bytecodec.Marshal(s)
+
+		expectedBytes := []byte{0x02, 0x01, 0x03}
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedBytes, actualBytes)
+	})
+}
@@ -11,14 +11,22 @@ import (
 const defaultPollingInterval = 30
 
 func (z *ZStack) startNetworkManager() {
-	go z.networkManager()
+	z.stopNetworkManager()
+
+	ctx, cancel := context.WithCancel(z.ctx)
+	z.networkManagerCancel = cancel
+
+	z.goBackground(func() { z.networkManager(ctx) })
 }
 
 func (z *ZStack) stopNetworkManager() {
-	z.networkManagerStop <- true
+	if z.networkManagerCancel != nil {
+		z.networkManagerCancel()
+		z.networkManagerCancel = nil
+	}
 }
 
-func (z *ZStack) networkManager() {
+func (z *ZStack) networkManager(ctx context.Context) {
 	z.nodeTable.addOrUpdate(z.NetworkProperties.IEEEAddress, z.NetworkProperties.NetworkAddress, logicalType(zigbee.Coordinator))
 
 	immediateStart := make(chan bool, 1)
@@ -40,15 +48,15 @@ func (z *ZStack) networkManager() {
 	_, cancel = z.subscriber.Subscribe(&ZdoNWKAddrRsp{}, z.receiveNWKAddrRsp)
 	defer cancel()
 
-	z.nodeTable.registerCallback(z.nodeTableUpdate)
+	z.nodeTableCallbackOnce.Do(func() { z.nodeTable.registerCallback(z.nodeTableUpdate) })
 
 	for {
 		select {
 		case <-immediateStart:
 			z.pollRoutersForNetworkStatus()
-		case <-time.After(defaultPollingInterval * time.Second):
+		case <-time.After(z.config.pollingInterval):
 			z.pollRoutersForNetworkStatus()
-		case <-z.networkManagerStop:
+		case <-ctx.Done():
 			return
 		case ue := <-z.networkManagerIncoming:
 			switch e := ue.(type) {
@@ -83,19 +91,23 @@ func (z *ZStack) newNode(e ZdoEndDeviceAnnceInd) {
 	z.nodeTable.addOrUpdate(e.IEEEAddress, e.NetworkAddress, logicalType(deviceLogicalType), updateDiscovered(), updateReceived())
 	node, _ := z.nodeTable.getByIEEE(e.IEEEAddress)
 
+	z.sleepyQueue.setSleepy(e.IEEEAddress, !e.Capabilities.Router && !e.Capabilities.ReceiveOnIdle)
+	z.releaseQueuedMessages(e.IEEEAddress)
+
 	z.sendEvent(zigbee.NodeJoinEvent{
 		Node: node,
 	})
 
 	if deviceLogicalType == zigbee.Router {
 		node, _ := z.nodeTable.getByIEEE(e.IEEEAddress)
-		go z.pollNodeForNetworkStatus(node)
+		z.goBackground(func() { z.pollNodeForNetworkStatus(node) })
 	}
 }
 
 func (z *ZStack) removeNode(ieee zigbee.IEEEAddress) bool {
 	node, found := z.nodeTable.getByIEEE(ieee)
 	z.nodeTable.remove(ieee)
+	z.sleepyQueue.remove(ieee)
 
 	if found {
 		z.sendEvent(zigbee.NodeLeaveEvent{
@@ -109,25 +121,26 @@ func (z *ZStack) removeNode(ieee zigbee.IEEEAddress) bool {
 func (z *ZStack) pollRoutersForNetworkStatus() {
 	for _, node := range z.nodeTable.nodes() {
 		if node.LogicalType == zigbee.Coordinator || node.LogicalType == zigbee.Router {
-			go z.pollNodeForNetworkStatus(node)
+			z.goBackground(func() { z.pollNodeForNetworkStatus(node) })
 		}
 	}
 }
 
 func (z *ZStack) pollNodeForNetworkStatus(node zigbee.Node) {
-	z.logger.LogDebug(context.Background(), "Polling device for network status.", logwrap.Datum("IEEEAddress", node.IEEEAddress.String()), logwrap.Datum("NetworkAddress", node.NetworkAddress))
+	z.logger.LogDebug(z.ctx, "Polling device for network status.", logwrap.Datum("IEEEAddress", node.IEEEAddress.String()), logwrap.Datum("NetworkAddress", node.NetworkAddress))
 	z.requestLQITable(node, 0)
 }
 
 func (z *ZStack) requestLQITable(node zigbee.Node, startIndex uint8) {
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultZStackTimeout)
+	ctx, cancel := context.WithTimeout(z.ctx, z.config.timeout)
 	defer cancel()
 
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		z.logger.LogError(ctx, "Failed to request LQI table, failed to acquire semaphore ", logwrap.Datum("IEEEAddress", node.IEEEAddress.String()), logwrap.Datum("NetworkAddress", node.NetworkAddress), logwrap.Err(err))
+	release, err := z.scheduler.acquire(ctx, PriorityBackground, node.NetworkAddress)
+	if err != nil {
+		z.logger.LogError(ctx, "Failed to request LQI table, failed to acquire request slot.", logwrap.Datum("IEEEAddress", node.IEEEAddress.String()), logwrap.Datum("NetworkAddress", node.NetworkAddress), logwrap.Err(err))
 		return
 	}
-	defer z.sem.Release(1)
+	defer release()
 
 	resp := ZdoMGMTLQIReqReply{}
 	z.logger.LogDebug(ctx, "Requesting LQI table from device.", logwrap.Datum("IEEEAddress", node.IEEEAddress.String()), logwrap.Datum("NetworkAddress", node.NetworkAddress), logwrap.Datum("StartIndex", startIndex))
@@ -154,6 +167,13 @@ func (z *ZStack) processLQITable(lqiResp ZdoMGMTLQIRsp) {
 
 		z.nodeTable.addOrUpdate(neighbour.IEEEAddress, neighbour.NetworkAddress, logicalType(neighbour.Status.DeviceType), updateDiscovered())
 
+		switch neighbour.Status.RxOnWhenIdle {
+		case neighbourRxOffWhenIdle:
+			z.sleepyQueue.setSleepy(neighbour.IEEEAddress, neighbour.Status.DeviceType == zigbee.EndDevice)
+		case neighbourRxOnWhenIdle:
+			z.sleepyQueue.setSleepy(neighbour.IEEEAddress, false)
+		}
+
 		if neighbour.Status.Relationship == zigbee.RelationshipChild {
 			z.nodeTable.update(neighbour.IEEEAddress, lqi(neighbour.LQI), depth(neighbour.Depth))
 		}
@@ -171,29 +191,36 @@ func (z *ZStack) processLQITable(lqiResp ZdoMGMTLQIRsp) {
 	}
 }
 
+func (z *ZStack) forwardToNetworkManager(msg interface{}) {
+	select {
+	case z.networkManagerIncoming <- msg:
+	case <-z.ctx.Done():
+	}
+}
+
 func (z *ZStack) receiveLQIUpdate(v interface{}) {
 	msg := v.(*ZdoMGMTLQIRsp)
-	z.networkManagerIncoming <- *msg
+	z.forwardToNetworkManager(*msg)
 }
 
 func (z *ZStack) receiveEndDeviceAnnouncement(v interface{}) {
 	msg := v.(*ZdoEndDeviceAnnceInd)
-	z.networkManagerIncoming <- *msg
+	z.forwardToNetworkManager(*msg)
 }
 
 func (z *ZStack) receiveLeaveAnnouncement(v interface{}) {
 	msg := v.(*ZdoLeaveInd)
-	z.networkManagerIncoming <- *msg
+	z.forwardToNetworkManager(*msg)
 }
 
 func (z *ZStack) receiveIEEEAddrRsp(v interface{}) {
 	msg := v.(*ZdoIEEEAddrRsp)
-	z.networkManagerIncoming <- *msg
+	z.forwardToNetworkManager(*msg)
 }
 
 func (z *ZStack) receiveNWKAddrRsp(v interface{}) {
 	msg := v.(*ZdoNWKAddrRsp)
-	z.networkManagerIncoming <- *msg
+	z.forwardToNetworkManager(*msg)
 }
 
 func (z *ZStack) nodeTableUpdate(node zigbee.Node) {
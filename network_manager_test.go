@@ -8,7 +8,6 @@ import (
 	unpiTest "github.com/shimmeringbee/unpi/testing"
 	"github.com/shimmeringbee/zigbee"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/sync/semaphore"
 	"testing"
 	"time"
 )
@@ -17,9 +16,10 @@ func Test_NetworkManager(t *testing.T) {
 	t.Run("issues a lqi poll request only for coordinators or routers", func(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
-		defer zstack.Stop()
+		defer zstack.Stop(context.Background())
 
 		unpiMock.On(SREQ, ZDO, ZdoMGMTLQIReqID).Return(Frame{
 			MessageType: SRSP,
@@ -32,7 +32,7 @@ func Test_NetworkManager(t *testing.T) {
 		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(2), zigbee.NetworkAddress(2), logicalType(zigbee.Unknown))
 
 		zstack.startNetworkManager()
-		defer zstack.stopNetworkManager()
+		defer zstack.Stop(context.Background())
 
 		time.Sleep(10 * time.Millisecond)
 
@@ -42,9 +42,10 @@ func Test_NetworkManager(t *testing.T) {
 	t.Run("the coordinator is added to the node list as a coordinator", func(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
-		defer zstack.Stop()
+		defer zstack.Stop(context.Background())
 
 		expectedIEEE := zigbee.IEEEAddress(0x0002)
 		expectedAddress := zigbee.NetworkAddress(0x0001)
@@ -60,7 +61,7 @@ func Test_NetworkManager(t *testing.T) {
 		})
 
 		zstack.startNetworkManager()
-		defer zstack.stopNetworkManager()
+		defer zstack.Stop(context.Background())
 
 		time.Sleep(10 * time.Millisecond)
 
@@ -76,12 +77,13 @@ func Test_NetworkManager(t *testing.T) {
 	t.Run("a node is added to the node table when an ZdoIEEEAddrRsp messages are received", func(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 		defer unpiMock.AssertCalls(t)
 
 		zstack.startNetworkManager()
-		defer zstack.stopNetworkManager()
+		defer zstack.Stop(context.Background())
 
 		unpiMock.On(SREQ, ZDO, ZdoMGMTLQIReqID).Return(Frame{
 			MessageType: SRSP,
@@ -111,12 +113,13 @@ func Test_NetworkManager(t *testing.T) {
 	t.Run("a node is added to the node table when an ZdoNWKAddrRsp messages are received", func(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 		defer unpiMock.AssertCalls(t)
 
 		zstack.startNetworkManager()
-		defer zstack.stopNetworkManager()
+		defer zstack.Stop(context.Background())
 
 		unpiMock.On(SREQ, ZDO, ZdoMGMTLQIReqID).Return(Frame{
 			MessageType: SRSP,
@@ -149,7 +152,8 @@ func Test_NetworkManager(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 		defer unpiMock.AssertCalls(t)
 
@@ -161,7 +165,7 @@ func Test_NetworkManager(t *testing.T) {
 		}).UnlimitedTimes()
 
 		zstack.startNetworkManager()
-		defer zstack.stopNetworkManager()
+		defer zstack.Stop(context.Background())
 
 		time.Sleep(10 * time.Millisecond)
 
@@ -216,7 +220,8 @@ func Test_NetworkManager(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 		defer unpiMock.AssertCalls(t)
 
@@ -228,7 +233,7 @@ func Test_NetworkManager(t *testing.T) {
 		}).UnlimitedTimes()
 
 		zstack.startNetworkManager()
-		defer zstack.stopNetworkManager()
+		defer zstack.Stop(context.Background())
 
 		announce := ZdoLeaveInd{
 			SourceAddress: zigbee.NetworkAddress(0x2000),
@@ -265,7 +270,8 @@ func Test_NetworkManager(t *testing.T) {
 	t.Run("a new router will be queried for network state", func(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 		defer unpiMock.AssertCalls(t)
 
@@ -277,7 +283,7 @@ func Test_NetworkManager(t *testing.T) {
 		}).Times(2)
 
 		zstack.startNetworkManager()
-		defer zstack.stopNetworkManager()
+		defer zstack.Stop(context.Background())
 
 		time.Sleep(10 * time.Millisecond)
 
@@ -320,7 +326,8 @@ func Test_NetworkManager(t *testing.T) {
 	t.Run("nodes in lqi query are added to network manager", func(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 		defer unpiMock.AssertCalls(t)
 
@@ -332,7 +339,7 @@ func Test_NetworkManager(t *testing.T) {
 		}).UnlimitedTimes()
 
 		zstack.startNetworkManager()
-		defer zstack.stopNetworkManager()
+		defer zstack.Stop(context.Background())
 
 		time.Sleep(10 * time.Millisecond)
 
@@ -382,7 +389,8 @@ func Test_NetworkManager(t *testing.T) {
 	t.Run("nodes in lqi query are added to network manager", func(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 		defer unpiMock.AssertCalls(t)
 
@@ -426,7 +434,8 @@ func Test_NetworkManager(t *testing.T) {
 	t.Run("nodes in lqi query are not added if Ext PANID does not match", func(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 		defer unpiMock.AssertCalls(t)
 
@@ -438,7 +447,7 @@ func Test_NetworkManager(t *testing.T) {
 		}).UnlimitedTimes()
 
 		zstack.startNetworkManager()
-		defer zstack.stopNetworkManager()
+		defer zstack.Stop(context.Background())
 
 		time.Sleep(10 * time.Millisecond)
 
@@ -483,7 +492,8 @@ func Test_NetworkManager(t *testing.T) {
 	t.Run("nodes in lqi query are not added if it has an invalid IEEE address", func(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		zstack.NetworkProperties.IEEEAddress = zigbee.IEEEAddress(1)
 
 		defer unpiMock.Stop()
@@ -497,7 +507,7 @@ func Test_NetworkManager(t *testing.T) {
 		}).UnlimitedTimes()
 
 		zstack.startNetworkManager()
-		defer zstack.stopNetworkManager()
+		defer zstack.Stop(context.Background())
 
 		time.Sleep(10 * time.Millisecond)
 
@@ -545,7 +555,8 @@ func Test_NetworkManager(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 		defer unpiMock.AssertCalls(t)
 
@@ -557,7 +568,7 @@ func Test_NetworkManager(t *testing.T) {
 		}).UnlimitedTimes()
 
 		zstack.startNetworkManager()
-		defer zstack.stopNetworkManager()
+		defer zstack.Stop(context.Background())
 
 		time.Sleep(10 * time.Millisecond)
 
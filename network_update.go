@@ -0,0 +1,125 @@
+package zstack
+
+import (
+	"context"
+	"fmt"
+	"github.com/shimmeringbee/zigbee"
+)
+
+const DefaultEnergyScanDuration uint8 = 3
+
+const (
+	MgmtNwkUpdateAddrModeShort     uint8 = 0x02
+	MgmtNwkUpdateAddrModeBroadcast uint8 = 0x0f
+)
+
+func (z *ZStack) ScanEnergy(ctx context.Context, channels []uint8, duration uint8) (map[uint8]uint8, error) {
+	if err := z.checkReady(); err != nil {
+		return nil, err
+	}
+
+	channelMask, err := channelsToMask(channels)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := z.scheduler.acquire(ctx, PriorityBackground, z.NetworkProperties.NetworkAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire request slot: %w", err)
+	}
+	defer release()
+
+	coordinatorAddress := z.NetworkProperties.NetworkAddress
+
+	request := ZdoMgmtNwkUpdateReq{
+		DestinationAddress:    coordinatorAddress,
+		DestinationAddrMode:   MgmtNwkUpdateAddrModeShort,
+		ChannelMask:           channelMask,
+		ScanDuration:          duration,
+		ScanCount:             1,
+		NetworkManagerAddress: coordinatorAddress,
+	}
+
+	resp, err := z.nodeRequest(ctx, &request, &ZdoMgmtNwkUpdateReqReply{}, &ZdoMgmtNwkUpdateNotify{}, func(i interface{}) bool {
+		msg := i.(*ZdoMgmtNwkUpdateNotify)
+		return msg.SourceAddress == coordinatorAddress
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notify := resp.(*ZdoMgmtNwkUpdateNotify)
+	scannedChannels := maskToChannels(notify.ScannedChannels)
+
+	if len(scannedChannels) != len(notify.EnergyValues) {
+		return nil, fmt.Errorf("energy scan returned %d values for %d channels", len(notify.EnergyValues), len(scannedChannels))
+	}
+
+	energies := map[uint8]uint8{}
+
+	for i, channel := range scannedChannels {
+		energies[channel] = notify.EnergyValues[i]
+	}
+
+	return energies, nil
+}
+
+func channelsToMask(channels []uint8) (uint32, error) {
+	var mask uint32
+
+	for _, channel := range channels {
+		if channel < zigbee.Channels[0] || channel > zigbee.Channels[len(zigbee.Channels)-1] {
+			return 0, fmt.Errorf("invalid zigbee channel: %d", channel)
+		}
+
+		mask |= 1 << channel
+	}
+
+	return mask, nil
+}
+
+func maskToChannels(mask uint32) []uint8 {
+	var channels []uint8
+
+	for _, channel := range zigbee.Channels {
+		if mask&(1<<channel) != 0 {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels
+}
+
+type ZdoMgmtNwkUpdateReq struct {
+	DestinationAddress    zigbee.NetworkAddress
+	DestinationAddrMode   uint8
+	ChannelMask           uint32
+	ScanDuration          uint8
+	ScanCount             uint8
+	NetworkManagerAddress zigbee.NetworkAddress
+}
+
+const ZdoMgmtNwkUpdateReqID uint8 = 0x37
+
+type ZdoMgmtNwkUpdateReqReply GenericZStackStatus
+
+func (r ZdoMgmtNwkUpdateReqReply) WasSuccessful() bool {
+	return r.Status == ZSuccess
+}
+
+const ZdoMgmtNwkUpdateReqReplyID uint8 = 0x37
+
+type ZdoMgmtNwkUpdateNotify struct {
+	SourceAddress        zigbee.NetworkAddress
+	Status               ZStackStatus
+	ScannedChannels      uint32
+	TotalTransmissions   uint16
+	TransmissionFailures uint16
+	EnergyValues         []uint8 `bcsliceprefix:"8"`
+}
+
+func (r ZdoMgmtNwkUpdateNotify) WasSuccessful() bool {
+	return r.Status == ZSuccess
+}
+
+const ZdoMgmtNwkUpdateNotifyID uint8 = 0xb8
@@ -0,0 +1,125 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestZStack_ScanEnergy(t *testing.T) {
+	t.Run("returns energy per channel from the coordinators update notification", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		call := unpiMock.On(SREQ, ZDO, ZdoMgmtNwkUpdateReqID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoMgmtNwkUpdateReqReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		notify, _ := bytecodec.Marshal(ZdoMgmtNwkUpdateNotify{
+			SourceAddress:   0x0000,
+			Status:          ZSuccess,
+			ScannedChannels: 1<<11 | 1<<15 | 1<<20,
+			EnergyValues:    []uint8{0x10, 0x80, 0x20},
+		})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   ZDO,
+				CommandID:   ZdoMgmtNwkUpdateNotifyID,
+				Payload:     notify,
+			})
+		}()
+
+		energies, err := zstack.ScanEnergy(ctx, []uint8{11, 15, 20}, DefaultEnergyScanDuration)
+		assert.NoError(t, err)
+		assert.Equal(t, map[uint8]uint8{11: 0x10, 15: 0x80, 20: 0x20}, energies)
+
+		request := ZdoMgmtNwkUpdateReq{}
+		bytecodec.Unmarshal(call.CapturedCalls[0].Frame.Payload, &request)
+
+		assert.Equal(t, zigbee.NetworkAddress(0x0000), request.DestinationAddress)
+		assert.Equal(t, MgmtNwkUpdateAddrModeShort, request.DestinationAddrMode)
+		assert.Equal(t, uint32(1<<11|1<<15|1<<20), request.ChannelMask)
+		assert.Equal(t, DefaultEnergyScanDuration, request.ScanDuration)
+		assert.Equal(t, uint8(1), request.ScanCount)
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("returns an error if an invalid channel is requested", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		_, err := zstack.ScanEnergy(ctx, []uint8{10}, DefaultEnergyScanDuration)
+		assert.Error(t, err)
+
+		unpiMock.AssertCalls(t)
+	})
+}
+
+func Test_maskToChannels(t *testing.T) {
+	t.Run("converts a mask into a list of channels", func(t *testing.T) {
+		assert.Equal(t, []uint8{11, 26}, maskToChannels(1<<11|1<<26))
+	})
+}
+
+func Test_ZdoMgmtNwkUpdateStructs(t *testing.T) {
+	t.Run("ZdoMgmtNwkUpdateReq", func(t *testing.T) {
+		s := ZdoMgmtNwkUpdateReq{
+			DestinationAddress:    0x0102,
+			DestinationAddrMode:   MgmtNwkUpdateAddrModeShort,
+			ChannelMask:           0x03040506,
+			ScanDuration:          0x07,
+			ScanCount:             0x08,
+			NetworkManagerAddress: 0x090a,
+		}
+
+		actualBytes, err := bytecodec.Marshal(s)
+
+		expectedBytes := []byte{0x02, 0x01, 0x02, 0x06, 0x05, 0x04, 0x03, 0x07, 0x08, 0x0a, 0x09}
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedBytes, actualBytes)
+	})
+
+	t.Run("ZdoMgmtNwkUpdateNotify", func(t *testing.T) {
+		s := ZdoMgmtNwkUpdateNotify{
+			SourceAddress:        0x0102,
+			Status:               ZSuccess,
+			ScannedChannels:      0x03040506,
+			TotalTransmissions:   0x0708,
+			TransmissionFailures: 0x090a,
+			EnergyValues:         []uint8{0x0b, 0x0c},
+		}
+
+		actualBytes, err := bytecodec.Marshal(s)
+
+		expectedBytes := []byte{0x02, 0x01, 0x00, 0x06, 0x05, 0x04, 0x03, 0x08, 0x07, 0x0a, 0x09, 0x02, 0x0b, 0x0c}
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedBytes, actualBytes)
+	})
+}
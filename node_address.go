@@ -26,10 +26,15 @@ func (z *ZStack) ResolveNodeNWKAddress(ctx context.Context, address zigbee.IEEEA
 }
 
 func (z *ZStack) QueryNodeIEEEAddress(ctx context.Context, address zigbee.NetworkAddress) (zigbee.IEEEAddress, error) {
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		return zigbee.EmptyIEEEAddress, fmt.Errorf("failed to acquire semaphore: %w", err)
+	if err := z.checkReady(); err != nil {
+		return zigbee.EmptyIEEEAddress, err
+	}
+
+	release, err := z.scheduler.acquire(ctx, PriorityInterview, address)
+	if err != nil {
+		return zigbee.EmptyIEEEAddress, fmt.Errorf("failed to acquire request slot: %w", err)
 	}
-	defer z.sem.Release(1)
+	defer release()
 
 	request := ZdoIEEEAddrReq{
 		NetworkAddress: address,
@@ -53,10 +58,15 @@ func (z *ZStack) QueryNodeIEEEAddress(ctx context.Context, address zigbee.Networ
 }
 
 func (z *ZStack) QueryNodeNWKAddress(ctx context.Context, address zigbee.IEEEAddress) (zigbee.NetworkAddress, error) {
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		return zigbee.NetworkAddress(0x0), fmt.Errorf("failed to acquire semaphore: %w", err)
+	if err := z.checkReady(); err != nil {
+		return zigbee.NetworkAddress(0x0), err
+	}
+
+	release, err := z.scheduler.acquire(ctx, PriorityInterview, zigbee.BroadcastAll)
+	if err != nil {
+		return zigbee.NetworkAddress(0x0), fmt.Errorf("failed to acquire request slot: %w", err)
 	}
-	defer z.sem.Release(1)
+	defer release()
 
 	request := ZdoNWKAddrReq{
 		IEEEAddress: address,
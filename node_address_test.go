@@ -8,7 +8,6 @@ import (
 	unpiTest "github.com/shimmeringbee/unpi/testing"
 	"github.com/shimmeringbee/zigbee"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/sync/semaphore"
 	"testing"
 	"time"
 )
@@ -21,7 +20,8 @@ func Test_ResolveNodeIEEEAddress(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		defer unpiMock.AssertCalls(t)
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		zstack.nodeTable.addOrUpdate(0x1122334455667788, 0xaabb)
@@ -38,7 +38,8 @@ func Test_ResolveNodeIEEEAddress(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		defer unpiMock.AssertCalls(t)
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		call := unpiMock.On(SREQ, ZDO, ZdoIEEEAddrReqID).Return(Frame{
@@ -79,7 +80,8 @@ func Test_QueryNodeIEEEAddress(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		defer unpiMock.AssertCalls(t)
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		call := unpiMock.On(SREQ, ZDO, ZdoIEEEAddrReqID).Return(Frame{
@@ -120,7 +122,8 @@ func Test_ResolveNodeNWKAddress(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		defer unpiMock.AssertCalls(t)
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		zstack.nodeTable.addOrUpdate(0x1122334455667788, 0xaabb)
@@ -137,7 +140,8 @@ func Test_ResolveNodeNWKAddress(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		defer unpiMock.AssertCalls(t)
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		call := unpiMock.On(SREQ, ZDO, ZdoNWKAddrReqID).Return(Frame{
@@ -178,7 +182,8 @@ func Test_QueryNodeNWKAddress(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		defer unpiMock.AssertCalls(t)
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		call := unpiMock.On(SREQ, ZDO, ZdoNWKAddrReqID).Return(Frame{
@@ -7,15 +7,26 @@ import (
 )
 
 func (z *ZStack) BindNodeToController(ctx context.Context, nodeAddress zigbee.IEEEAddress, sourceEndpoint zigbee.Endpoint, destinationEndpoint zigbee.Endpoint, cluster zigbee.ClusterID) error {
+	if err := z.checkReady(); err != nil {
+		return err
+	}
+
+	lease, err := z.acquireNodeGuard(ctx, nodeAddress)
+	if err != nil {
+		return err
+	}
+	defer func() { lease.done(err) }()
+
 	networkAddress, err := z.ResolveNodeNWKAddress(ctx, nodeAddress)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		return fmt.Errorf("failed to acquire semaphore: %w", err)
+	release, err := z.scheduler.acquire(ctx, PriorityInteractive, networkAddress)
+	if err != nil {
+		return fmt.Errorf("failed to acquire request slot: %w", err)
 	}
-	defer z.sem.Release(1)
+	defer release()
 
 	request := ZdoBindReq{
 		TargetAddress:          networkAddress,
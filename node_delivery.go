@@ -0,0 +1,155 @@
+package zstack
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/logwrap"
+	"github.com/shimmeringbee/zigbee"
+	"time"
+)
+
+type DeliveryPolicy struct {
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+var DefaultDeliveryPolicy = DeliveryPolicy{
+	Attempts:       3,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
+/* Opts SendApplicationMessageToNode into delivery aware retries for messages that require an acknowledgement. */
+func WithDeliveryPolicy(policy DeliveryPolicy) Option {
+	return func(o *options) {
+		o.deliveryPolicy = &policy
+	}
+}
+
+type DeliveryAttempt struct {
+	NetworkAddress          zigbee.NetworkAddress
+	Err                     error
+	Readdressed             bool
+	RouteDiscoveryRequested bool
+	Backoff                 time.Duration
+}
+
+type DeliveryReport struct {
+	Delivered bool
+	Attempts  []DeliveryAttempt
+}
+
+const DefaultRouteDiscoveryOptions uint8 = 0x00
+
+func (z *ZStack) SendApplicationMessageToNodeWithDelivery(ctx context.Context, destinationAddress zigbee.IEEEAddress, message zigbee.ApplicationMessage, policy DeliveryPolicy) (DeliveryReport, error) {
+	if err := z.checkReady(); err != nil {
+		return DeliveryReport{}, err
+	}
+
+	network, err := z.ResolveNodeNWKAddress(ctx, destinationAddress)
+	if err != nil {
+		return DeliveryReport{}, err
+	}
+
+	lease, err := z.acquireNodeGuard(ctx, destinationAddress)
+	if err != nil {
+		return DeliveryReport{}, err
+	}
+
+	report, err := z.deliverApplicationMessage(ctx, destinationAddress, network, message, policy)
+	lease.done(err)
+
+	return report, err
+}
+
+func (z *ZStack) deliverApplicationMessage(ctx context.Context, ieee zigbee.IEEEAddress, network zigbee.NetworkAddress, message zigbee.ApplicationMessage, policy DeliveryPolicy) (DeliveryReport, error) {
+	report := DeliveryReport{}
+	backoff := policy.InitialBackoff
+	attempts := max(policy.Attempts, 1)
+
+	for i := 0; i < attempts; i++ {
+		err := z.sendApplicationMessage(ctx, network, message, true)
+		report.Attempts = append(report.Attempts, DeliveryAttempt{NetworkAddress: network, Err: err})
+
+		if err == nil {
+			report.Delivered = true
+			return report, nil
+		}
+
+		if !isRoutingFailure(err) || i == attempts-1 {
+			return report, err
+		}
+
+		attempt := &report.Attempts[len(report.Attempts)-1]
+
+		z.logger.LogWarn(ctx, "Application message was not delivered due to routing failure, rediscovering node.", logwrap.Datum("IEEEAddress", ieee.String()), logwrap.Datum("NetworkAddress", network), logwrap.Err(err))
+
+		if resolved, err := z.QueryNodeNWKAddress(ctx, ieee); err == nil {
+			if resolved != network {
+				z.nodeTable.addOrUpdate(ieee, resolved)
+				attempt.Readdressed = true
+				network = resolved
+			}
+		}
+
+		if err := z.requestRouteDiscovery(ctx, network); err == nil {
+			attempt.RouteDiscoveryRequested = true
+		} else {
+			z.logger.LogWarn(ctx, "Failed to request route discovery.", logwrap.Datum("NetworkAddress", network), logwrap.Err(err))
+		}
+
+		attempt.Backoff = backoff
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return report, errors.New("context expired while waiting to retry application message")
+		}
+
+		backoff = min(backoff*2, policy.MaxBackoff)
+	}
+
+	return report, nil
+}
+
+func isRoutingFailure(err error) bool {
+	var statusErr ZStackStatusError
+
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+
+	switch statusErr.Status {
+	case ZMacNoAck, ZMacTransactionExpired, ZNwkNoRoute, ZNwkNoAck, ZNwkUnknownDevice, ZApsNoAck:
+		return true
+	default:
+		return false
+	}
+}
+
+func (z *ZStack) requestRouteDiscovery(ctx context.Context, network zigbee.NetworkAddress) error {
+	reply := ZdoExtRouteDiscReply{}
+
+	if err := z.requestResponder.RequestResponse(ctx, ZdoExtRouteDisc{DestinationAddress: network, Options: DefaultRouteDiscoveryOptions, Radius: z.config.radius}, &reply); err != nil {
+		return err
+	}
+
+	if reply.Status != ZSuccess {
+		return ZStackStatusError{Err: ErrorZFailure, Status: reply.Status}
+	}
+
+	return nil
+}
+
+type ZdoExtRouteDisc struct {
+	DestinationAddress zigbee.NetworkAddress
+	Options            uint8
+	Radius             uint8
+}
+
+const ZdoExtRouteDiscID uint8 = 0x45
+
+type ZdoExtRouteDiscReply GenericZStackStatus
+
+const ZdoExtRouteDiscReplyID uint8 = 0x45
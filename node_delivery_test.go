@@ -0,0 +1,154 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_SendApplicationMessageToNodeWithDelivery(t *testing.T) {
+	appMessage := zigbee.ApplicationMessage{
+		ClusterID:           0x2000,
+		SourceEndpoint:      0x03,
+		DestinationEndpoint: 0x04,
+		Data:                []byte{0x0a, 0x0b},
+	}
+
+	policy := DeliveryPolicy{Attempts: 3, InitialBackoff: 50 * time.Millisecond, MaxBackoff: 100 * time.Millisecond}
+
+	t.Run("rediscovers the node after a routing failure and retries", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		dataCall := unpiMock.On(SREQ, AF, AfDataRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestReplyID,
+			Payload:     []byte{0x00},
+		}).Times(2)
+
+		unpiMock.On(SREQ, ZDO, ZdoNWKAddrReqID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoNWKAddrReqReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		routeCall := unpiMock.On(SREQ, ZDO, ZdoExtRouteDiscID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoExtRouteDiscReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   AF,
+				CommandID:   AfDataConfirmID,
+				Payload:     []byte{byte(ZNwkNoRoute), 0x04, 0x00},
+			})
+
+			time.Sleep(20 * time.Millisecond)
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   ZDO,
+				CommandID:   ZdoNWKAddrRspID,
+				Payload:     []byte{0x00, 0x88, 0x77, 0x66, 0x55, 0x44, 0x33, 0x22, 0x11, 0x00, 0x20, 0x00, 0x00},
+			})
+
+			time.Sleep(100 * time.Millisecond)
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   AF,
+				CommandID:   AfDataConfirmID,
+				Payload:     []byte{0x00, 0x04, 0x01},
+			})
+		}()
+
+		report, err := zstack.SendApplicationMessageToNodeWithDelivery(ctx, zigbee.IEEEAddress(0x1122334455667788), appMessage, policy)
+		assert.NoError(t, err)
+		assert.True(t, report.Delivered)
+
+		if assert.Len(t, report.Attempts, 2) {
+			assert.Equal(t, zigbee.NetworkAddress(0x1000), report.Attempts[0].NetworkAddress)
+			assert.ErrorIs(t, report.Attempts[0].Err, ZNwkNoRoute)
+			assert.True(t, report.Attempts[0].Readdressed)
+			assert.True(t, report.Attempts[0].RouteDiscoveryRequested)
+			assert.Equal(t, 50*time.Millisecond, report.Attempts[0].Backoff)
+
+			assert.Equal(t, zigbee.NetworkAddress(0x2000), report.Attempts[1].NetworkAddress)
+			assert.NoError(t, report.Attempts[1].Err)
+		}
+
+		routeReq := ZdoExtRouteDisc{}
+		bytecodec.Unmarshal(routeCall.CapturedCalls[0].Frame.Payload, &routeReq)
+		assert.Equal(t, zigbee.NetworkAddress(0x2000), routeReq.DestinationAddress)
+
+		dataReq := AfDataRequest{}
+		bytecodec.Unmarshal(dataCall.CapturedCalls[1].Frame.Payload, &dataReq)
+		assert.Equal(t, zigbee.NetworkAddress(0x2000), dataReq.DestinationAddress)
+
+		node, _ := zstack.nodeTable.getByIEEE(zigbee.IEEEAddress(0x1122334455667788))
+		assert.Equal(t, zigbee.NetworkAddress(0x2000), node.NetworkAddress)
+	})
+
+	t.Run("does not retry failures unrelated to routing", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		unpiMock.On(SREQ, AF, AfDataRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   AF,
+				CommandID:   AfDataConfirmID,
+				Payload:     []byte{byte(ZApsNotSupported), 0x04, 0x00},
+			})
+		}()
+
+		report, err := zstack.SendApplicationMessageToNodeWithDelivery(ctx, zigbee.IEEEAddress(0x1122334455667788), appMessage, policy)
+		assert.ErrorIs(t, err, ZApsNotSupported)
+		assert.False(t, report.Delivered)
+		assert.Len(t, report.Attempts, 1)
+	})
+}
+
+func Test_isRoutingFailure(t *testing.T) {
+	assert.True(t, isRoutingFailure(ZStackStatusError{Err: NodeResponseWasNotSuccess, Status: ZMacNoAck}))
+	assert.True(t, isRoutingFailure(ZStackStatusError{Err: NodeResponseWasNotSuccess, Status: ZApsNoAck}))
+	assert.False(t, isRoutingFailure(ZStackStatusError{Err: NodeResponseWasNotSuccess, Status: ZFailure}))
+	assert.False(t, isRoutingFailure(context.DeadlineExceeded))
+}
@@ -7,15 +7,26 @@ import (
 )
 
 func (z *ZStack) QueryNodeDescription(ctx context.Context, ieeeAddress zigbee.IEEEAddress) (zigbee.NodeDescription, error) {
+	if err := z.checkReady(); err != nil {
+		return zigbee.NodeDescription{}, err
+	}
+
+	lease, err := z.acquireNodeGuard(ctx, ieeeAddress)
+	if err != nil {
+		return zigbee.NodeDescription{}, err
+	}
+	defer func() { lease.done(err) }()
+
 	nwkAddress, err := z.ResolveNodeNWKAddress(ctx, ieeeAddress)
 	if err != nil {
 		return zigbee.NodeDescription{}, err
 	}
 
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		return zigbee.NodeDescription{}, fmt.Errorf("failed to acquire semaphore: %w", err)
+	release, err := z.scheduler.acquire(ctx, PriorityInterview, nwkAddress)
+	if err != nil {
+		return zigbee.NodeDescription{}, fmt.Errorf("failed to acquire request slot: %w", err)
 	}
-	defer z.sem.Release(1)
+	defer release()
 
 	request := ZdoNodeDescReq{
 		DestinationAddress: nwkAddress,
@@ -7,15 +7,26 @@ import (
 )
 
 func (z *ZStack) QueryNodeEndpointDescription(ctx context.Context, ieeeAddress zigbee.IEEEAddress, endpoint zigbee.Endpoint) (zigbee.EndpointDescription, error) {
+	if err := z.checkReady(); err != nil {
+		return zigbee.EndpointDescription{}, err
+	}
+
+	lease, err := z.acquireNodeGuard(ctx, ieeeAddress)
+	if err != nil {
+		return zigbee.EndpointDescription{}, err
+	}
+	defer func() { lease.done(err) }()
+
 	networkAddress, err := z.ResolveNodeNWKAddress(ctx, ieeeAddress)
 	if err != nil {
 		return zigbee.EndpointDescription{}, err
 	}
 
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		return zigbee.EndpointDescription{}, fmt.Errorf("failed to acquire semaphore: %w", err)
+	release, err := z.scheduler.acquire(ctx, PriorityInterview, networkAddress)
+	if err != nil {
+		return zigbee.EndpointDescription{}, fmt.Errorf("failed to acquire request slot: %w", err)
 	}
-	defer z.sem.Release(1)
+	defer release()
 
 	request := ZdoSimpleDescReq{
 		DestinationAddress: networkAddress,
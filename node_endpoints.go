@@ -7,15 +7,26 @@ import (
 )
 
 func (z *ZStack) QueryNodeEndpoints(ctx context.Context, ieeeAddress zigbee.IEEEAddress) ([]zigbee.Endpoint, error) {
+	if err := z.checkReady(); err != nil {
+		return nil, err
+	}
+
+	lease, err := z.acquireNodeGuard(ctx, ieeeAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { lease.done(err) }()
+
 	networkAddress, err := z.ResolveNodeNWKAddress(ctx, ieeeAddress)
 	if err != nil {
 		return []zigbee.Endpoint{}, err
 	}
 
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		return nil, fmt.Errorf("failed to acquire semaphore: %w", err)
+	release, err := z.scheduler.acquire(ctx, PriorityInterview, networkAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire request slot: %w", err)
 	}
-	defer z.sem.Release(1)
+	defer release()
 
 	request := ZdoActiveEpReq{
 		DestinationAddress: networkAddress,
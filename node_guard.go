@@ -0,0 +1,157 @@
+package zstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shimmeringbee/logwrap"
+	"github.com/shimmeringbee/zigbee"
+	"sync"
+	"time"
+)
+
+var ErrNodeUnreachable = errors.New("node unreachable")
+
+const (
+	DefaultNodeConcurrency         = 4
+	DefaultCircuitBreakerThreshold = 3
+	DefaultCircuitBreakerCooldown  = 30 * time.Second
+)
+
+func WithNodeConcurrency(limit int) Option {
+	return func(o *options) {
+		o.nodeConcurrency = limit
+	}
+}
+
+/* A threshold of zero disables the circuit breaker. */
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(o *options) {
+		o.circuitBreakerThreshold = threshold
+		o.circuitBreakerCooldown = cooldown
+	}
+}
+
+type circuitState uint8
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type nodeGuard struct {
+	slots    chan struct{}
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+type nodeGuards struct {
+	lock   sync.Mutex
+	guards map[zigbee.IEEEAddress]*nodeGuard
+}
+
+func newNodeGuards() *nodeGuards {
+	return &nodeGuards{guards: map[zigbee.IEEEAddress]*nodeGuard{}}
+}
+
+type nodeGuardLease struct {
+	z     *ZStack
+	ieee  zigbee.IEEEAddress
+	guard *nodeGuard
+	probe bool
+}
+
+func (z *ZStack) acquireNodeGuard(ctx context.Context, ieee zigbee.IEEEAddress) (*nodeGuardLease, error) {
+	node, _ := z.nodeTable.getByIEEE(ieee)
+
+	z.nodeGuards.lock.Lock()
+
+	g, found := z.nodeGuards.guards[ieee]
+	if !found {
+		g = &nodeGuard{slots: make(chan struct{}, max(z.config.nodeConcurrency, 1))}
+		z.nodeGuards.guards[ieee] = g
+	}
+
+	lease := &nodeGuardLease{z: z, ieee: ieee, guard: g}
+
+	if g.state != circuitClosed {
+		/* Any message heard from the node since the circuit opened shows it is back. */
+		if node.LastReceived.After(g.openedAt) {
+			g.state = circuitClosed
+			g.failures = 0
+		} else if g.state == circuitOpen && time.Since(g.openedAt) >= z.config.circuitBreakerCooldown {
+			g.state = circuitHalfOpen
+			lease.probe = true
+		} else {
+			z.nodeGuards.lock.Unlock()
+			return nil, fmt.Errorf("%w: %v", ErrNodeUnreachable, ieee)
+		}
+	}
+
+	z.nodeGuards.lock.Unlock()
+
+	select {
+	case g.slots <- struct{}{}:
+		return lease, nil
+	case <-ctx.Done():
+		lease.abandonProbe()
+		return nil, fmt.Errorf("context expired while waiting for node request slot: %w", ctx.Err())
+	}
+}
+
+/* Releases the slot without drawing any conclusion about the node's reachability. */
+func (l *nodeGuardLease) release() {
+	<-l.guard.slots
+	l.abandonProbe()
+}
+
+func (l *nodeGuardLease) abandonProbe() {
+	if !l.probe {
+		return
+	}
+
+	l.z.nodeGuards.lock.Lock()
+	defer l.z.nodeGuards.lock.Unlock()
+
+	if l.guard.state == circuitHalfOpen {
+		l.guard.state = circuitOpen
+	}
+}
+
+func (l *nodeGuardLease) done(err error) {
+	<-l.guard.slots
+
+	switch {
+	case isNodeFailure(err):
+		l.z.nodeGuards.lock.Lock()
+		l.guard.failures++
+
+		opened := l.z.config.circuitBreakerThreshold > 0 && l.guard.state != circuitOpen && (l.probe || l.guard.failures >= l.z.config.circuitBreakerThreshold)
+		if opened {
+			l.guard.state = circuitOpen
+			l.guard.openedAt = time.Now()
+		}
+		l.z.nodeGuards.lock.Unlock()
+
+		if opened {
+			l.z.logger.LogWarn(context.Background(), "Node has repeatedly failed to respond, failing requests until it is heard from.", logwrap.Datum("IEEEAddress", l.ieee.String()), logwrap.Err(err))
+		}
+	case isNodeAlive(err):
+		l.z.nodeGuards.lock.Lock()
+		l.guard.failures = 0
+		l.guard.state = circuitClosed
+		l.z.nodeGuards.lock.Unlock()
+	default:
+		l.abandonProbe()
+	}
+}
+
+func isNodeFailure(err error) bool {
+	return errors.Is(err, ErrNodeResponseTimeout) || isRoutingFailure(err)
+}
+
+func isNodeAlive(err error) bool {
+	return err == nil || (errors.Is(err, NodeResponseWasNotSuccess) && !isRoutingFailure(err))
+}
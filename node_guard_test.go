@@ -0,0 +1,126 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_NodeGuard(t *testing.T) {
+	ieee := zigbee.IEEEAddress(0x1122334455667788)
+
+	newGuardedZStack := func(t *testing.T, opts ...Option) *ZStack {
+		unpiMock := unpiTest.NewMockAdapter()
+		t.Cleanup(unpiMock.Stop)
+
+		zstack := New(unpiMock, memory.New(), opts...)
+		zstack.nodeTable.addOrUpdate(ieee, zigbee.NetworkAddress(0x1000))
+
+		return zstack
+	}
+
+	failNode := func(t *testing.T, zstack *ZStack) {
+		lease, err := zstack.acquireNodeGuard(context.Background(), ieee)
+		assert.NoError(t, err)
+		lease.done(ErrNodeResponseTimeout)
+	}
+
+	t.Run("limits the number of concurrent requests to a node", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		zstack := newGuardedZStack(t, WithNodeConcurrency(1))
+
+		lease, err := zstack.acquireNodeGuard(ctx, ieee)
+		assert.NoError(t, err)
+		defer lease.release()
+
+		_, err = zstack.acquireNodeGuard(ctx, ieee)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		other, err := zstack.acquireNodeGuard(context.Background(), zigbee.IEEEAddress(0x01))
+		assert.NoError(t, err)
+		other.release()
+	})
+
+	t.Run("fails fast once the failure threshold is reached", func(t *testing.T) {
+		zstack := newGuardedZStack(t, WithCircuitBreaker(2, time.Minute))
+
+		failNode(t, zstack)
+		failNode(t, zstack)
+
+		_, err := zstack.acquireNodeGuard(context.Background(), ieee)
+		assert.ErrorIs(t, err, ErrNodeUnreachable)
+	})
+
+	t.Run("routing failures from data confirms count towards the threshold", func(t *testing.T) {
+		zstack := newGuardedZStack(t, WithCircuitBreaker(1, time.Minute))
+
+		lease, _ := zstack.acquireNodeGuard(context.Background(), ieee)
+		lease.done(ZStackStatusError{Err: NodeResponseWasNotSuccess, Status: ZMacNoAck})
+
+		_, err := zstack.acquireNodeGuard(context.Background(), ieee)
+		assert.ErrorIs(t, err, ErrNodeUnreachable)
+	})
+
+	t.Run("a single probe is permitted after the cooldown, closing the circuit on success", func(t *testing.T) {
+		zstack := newGuardedZStack(t, WithCircuitBreaker(1, 10*time.Millisecond))
+
+		failNode(t, zstack)
+		time.Sleep(20 * time.Millisecond)
+
+		probe, err := zstack.acquireNodeGuard(context.Background(), ieee)
+		assert.NoError(t, err)
+
+		_, err = zstack.acquireNodeGuard(context.Background(), ieee)
+		assert.ErrorIs(t, err, ErrNodeUnreachable)
+
+		probe.done(nil)
+
+		lease, err := zstack.acquireNodeGuard(context.Background(), ieee)
+		assert.NoError(t, err)
+		lease.release()
+	})
+
+	t.Run("a failed probe reopens the circuit", func(t *testing.T) {
+		zstack := newGuardedZStack(t, WithCircuitBreaker(1, 10*time.Millisecond))
+
+		failNode(t, zstack)
+		time.Sleep(20 * time.Millisecond)
+
+		failNode(t, zstack)
+
+		_, err := zstack.acquireNodeGuard(context.Background(), ieee)
+		assert.ErrorIs(t, err, ErrNodeUnreachable)
+	})
+
+	t.Run("hearing from the node closes the circuit", func(t *testing.T) {
+		zstack := newGuardedZStack(t, WithCircuitBreaker(1, time.Minute))
+
+		failNode(t, zstack)
+
+		zstack.nodeTable.update(ieee, updateReceived())
+
+		lease, err := zstack.acquireNodeGuard(context.Background(), ieee)
+		assert.NoError(t, err)
+		lease.release()
+	})
+
+	t.Run("requests to unreachable nodes do not reach the adapter", func(t *testing.T) {
+		zstack := newGuardedZStack(t, WithCircuitBreaker(1, time.Minute))
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+
+		failNode(t, zstack)
+
+		_, err := zstack.QueryNodeEndpoints(context.Background(), ieee)
+		assert.ErrorIs(t, err, ErrNodeUnreachable)
+
+		err = zstack.SendApplicationMessageToNode(context.Background(), ieee, zigbee.ApplicationMessage{}, true)
+		assert.ErrorIs(t, err, ErrNodeUnreachable)
+	})
+}
@@ -7,10 +7,19 @@ import (
 )
 
 func (z *ZStack) startMessageReceiver() {
-	_, z.messageReceiverStop = z.subscriber.Subscribe(&AfIncomingMsg{}, func(v interface{}) {
+	z.stopMessageReceiver()
+
+	stopTracker := z.startTransactionTracker()
+
+	_, stopReceiver := z.subscriber.Subscribe(&AfIncomingMsg{}, func(v interface{}) {
 		msg := v.(*AfIncomingMsg)
 
-		ctx, cancel := context.WithTimeout(context.Background(), DefaultResolveIEEETimeout)
+		if !z.startBackground() {
+			return
+		}
+		defer z.background.Done()
+
+		ctx, cancel := context.WithTimeout(z.ctx, z.config.resolveIEEETimeout)
 		defer cancel()
 
 		ieee, err := z.ResolveNodeIEEEAddress(ctx, msg.SourceAddress)
@@ -43,12 +52,19 @@ func (z *ZStack) startMessageReceiver() {
 		})
 
 		z.nodeTable.update(ieee, updateReceived(), lqi(msg.LinkQuality))
+		z.releaseQueuedMessages(ieee)
 	})
+
+	z.messageReceiverStop = func() {
+		stopReceiver()
+		stopTracker()
+	}
 }
 
 func (z *ZStack) stopMessageReceiver() {
 	if z.messageReceiverStop != nil {
 		z.messageReceiverStop()
+		z.messageReceiverStop = nil
 	}
 }
 
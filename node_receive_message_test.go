@@ -93,6 +93,42 @@ func Test_ReceiveMessage(t *testing.T) {
 		n, _ := zstack.nodeTable.getByNetwork(zigbee.NetworkAddress(0x1000))
 		assert.Equal(t, uint8(55), n.LQI)
 	})
+
+	t.Run("restarting the receiver delivers each message once", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		sub := zstack.Subscribe(2, OverflowDropNewest, FilterEventType(zigbee.NodeIncomingMessageEvent{}))
+
+		zstack.startMessageReceiver()
+		zstack.startMessageReceiver()
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+
+			data, _ := bytecodec.Marshal(&AfIncomingMsg{SourceAddress: 0x1000, Data: []byte{0x01}})
+
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   AF,
+				CommandID:   AfIncomingMsgID,
+				Payload:     data,
+			})
+		}()
+
+		_, err := sub.ReadEvent(ctx)
+		assert.NoError(t, err)
+
+		_, err = sub.ReadEvent(ctx)
+		assert.Error(t, err)
+	})
 }
 
 func Test_IncomingMessage(t *testing.T) {
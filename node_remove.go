@@ -7,15 +7,26 @@ import (
 )
 
 func (z *ZStack) RequestNodeLeave(ctx context.Context, nodeAddress zigbee.IEEEAddress) error {
+	if err := z.checkReady(); err != nil {
+		return err
+	}
+
+	lease, err := z.acquireNodeGuard(ctx, nodeAddress)
+	if err != nil {
+		return err
+	}
+	defer func() { lease.done(err) }()
+
 	networkAddress, err := z.ResolveNodeNWKAddress(ctx, nodeAddress)
 	if err != nil {
 		return nil
 	}
 
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		return fmt.Errorf("failed to acquire semaphore: %w", err)
+	release, err := z.scheduler.acquire(ctx, PriorityInteractive, networkAddress)
+	if err != nil {
+		return fmt.Errorf("failed to acquire request slot: %w", err)
 	}
-	defer z.sem.Release(1)
+	defer release()
 
 	request := ZdoMgmtLeaveReq{
 		NetworkAddress: networkAddress,
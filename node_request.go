@@ -11,6 +11,7 @@ func AnyResponse(v interface{}) bool {
 
 var ReplyDoesNotReportSuccess = errors.New("reply struct does not support Successor interface")
 var NodeResponseWasNotSuccess = errors.New("response from node was not success")
+var ErrNodeResponseTimeout = errors.New("context expired while waiting for response from node")
 
 func (z *ZStack) nodeRequest(ctx context.Context, request interface{}, reply interface{}, response interface{}, responseFilter func(interface{}) bool) (interface{}, error) {
 	replySuccessor, replySupportsSuccessor := reply.(Successor)
@@ -19,6 +20,29 @@ func (z *ZStack) nodeRequest(ctx context.Context, request interface{}, reply int
 		return nil, ReplyDoesNotReportSuccess
 	}
 
+	return z.nodeRequestFunc(ctx, func(invokeCtx context.Context) error {
+		if err := z.requestResponder.RequestResponse(invokeCtx, request, reply); err != nil {
+			return err
+		}
+
+		if !replySuccessor.WasSuccessful() {
+			return statusError(ErrorZFailure, reply)
+		}
+
+		return nil
+	}, response, responseFilter)
+}
+
+/* As nodeRequest, for requests which take more than a single request and reply to send. */
+func (z *ZStack) nodeRequestFunc(ctx context.Context, send func(context.Context) error, response interface{}, responseFilter func(interface{}) bool) (interface{}, error) {
+	if !z.startBackground() {
+		return nil, ErrAdapterNotReady
+	}
+	defer z.background.Done()
+
+	ctx, cancel := z.withRootContext(ctx)
+	defer cancel()
+
 	ch := make(chan interface{})
 
 	err, stop := z.subscriber.Subscribe(response, func(v interface{}) {
@@ -35,23 +59,19 @@ func (z *ZStack) nodeRequest(ctx context.Context, request interface{}, reply int
 		return nil, err
 	}
 
-	if err := z.requestResponder.RequestResponse(ctx, request, reply); err != nil {
+	if err := send(ctx); err != nil {
 		return nil, err
 	}
 
-	if !replySuccessor.WasSuccessful() {
-		return nil, ErrorZFailure
-	}
-
 	select {
 	case v := <-ch:
 		responseSuccessor, responseSupportsSuccessor := v.(Successor)
 
 		if responseSupportsSuccessor && !responseSuccessor.WasSuccessful() {
-			return v, NodeResponseWasNotSuccess
+			return v, statusError(NodeResponseWasNotSuccess, v)
 		}
 		return v, nil
 	case <-ctx.Done():
-		return nil, errors.New("context expired while waiting for response from node")
+		return nil, ErrNodeResponseTimeout
 	}
 }
@@ -41,14 +41,15 @@ func Test_NodeRequest(t *testing.T) {
 			MessageType: SRSP,
 			Subsystem:   ZDO,
 			CommandID:   ZdoActiveEpReqReplyID,
-			Payload:     []byte{0x01},
+			Payload:     []byte{0xcd},
 		})
 
 		resp, err := zstack.nodeRequest(ctx, &ZdoActiveEpReq{}, &ZdoActiveEpReqReply{}, &ZdoActiveEpRsp{}, AnyResponse)
 
 		assert.Error(t, err)
 		assert.Nil(t, resp)
-		assert.Equal(t, ErrorZFailure, err)
+		assert.ErrorIs(t, err, ErrorZFailure)
+		assert.ErrorIs(t, err, ZNwkNoRoute)
 
 		unpiMock.AssertCalls(t)
 	})
@@ -206,7 +207,11 @@ func Test_NodeRequest(t *testing.T) {
 
 		assert.Error(t, err)
 		assert.True(t, ok)
-		assert.Equal(t, NodeResponseWasNotSuccess, err)
+		assert.ErrorIs(t, err, NodeResponseWasNotSuccess)
+
+		var statusErr ZStackStatusError
+		assert.ErrorAs(t, err, &statusErr)
+		assert.Equal(t, ZFailure, statusErr.Status)
 		assert.Equal(t, []zigbee.Endpoint{0x01, 0x02, 0x03}, castResp.ActiveEndpoints)
 
 		unpiMock.AssertCalls(t)
@@ -11,49 +11,159 @@ import (
 const DefaultRadius uint8 = 0x20
 
 func (z *ZStack) SendApplicationMessageToNode(ctx context.Context, destinationAddress zigbee.IEEEAddress, message zigbee.ApplicationMessage, requireAck bool) error {
+	if err := z.checkReady(); err != nil {
+		return err
+	}
+
 	network, err := z.ResolveNodeNWKAddress(ctx, destinationAddress)
 	if err != nil {
 		z.logger.LogError(ctx, "Failed to send AfDataRequest (application message), failed to resolve IEEE Address to Network Adddress.", logwrap.Err(err), logwrap.Datum("IEEEAddress", destinationAddress.String()))
 		return err
 	}
 
-	if err := z.sem.Acquire(ctx, 1); err != nil {
-		return fmt.Errorf("failed to acquire semaphore: %w", err)
+	if z.shouldQueueForNode(destinationAddress) {
+		z.queueMessageForNode(ctx, destinationAddress, message, requireAck)
+
+		/* Acknowledgement of a queued message is only known once it is released, and is reported by event. */
+		if requireAck {
+			return ErrMessageQueued
+		}
+
+		return nil
+	}
+
+	return z.sendApplicationMessageToNode(ctx, destinationAddress, network, message, requireAck)
+}
+
+func (z *ZStack) sendApplicationMessageToNode(ctx context.Context, destinationAddress zigbee.IEEEAddress, network zigbee.NetworkAddress, message zigbee.ApplicationMessage, requireAck bool) error {
+	lease, err := z.acquireNodeGuard(ctx, destinationAddress)
+	if err != nil {
+		return err
+	}
+
+	if !requireAck {
+		defer lease.release()
+		return z.sendApplicationMessage(ctx, network, message, false)
 	}
-	defer z.sem.Release(1)
 
-	var transactionId uint8
+	if z.config.deliveryPolicy != nil {
+		_, err = z.deliverApplicationMessage(ctx, destinationAddress, network, message, *z.config.deliveryPolicy)
+	} else {
+		err = z.sendApplicationMessage(ctx, network, message, true)
+	}
 
-	select {
-	case transactionId = <-z.transactionIdStore:
-		defer func() { z.transactionIdStore <- transactionId }()
-	case <-ctx.Done():
-		return errors.New("context expired while obtaining a free transaction ID")
+	lease.done(err)
+	return err
+}
+
+func (z *ZStack) sendApplicationMessage(ctx context.Context, network zigbee.NetworkAddress, message zigbee.ApplicationMessage, requireAck bool) error {
+	if err := z.checkPayloadSize(message, requireAck); err != nil {
+		return err
+	}
+
+	release, err := z.scheduler.acquire(ctx, PriorityInteractive, network)
+	if err != nil {
+		return fmt.Errorf("failed to acquire request slot: %w", err)
 	}
+	defer release()
 
-	request := AfDataRequest{
-		DestinationAddress:  network,
-		DestinationEndpoint: message.DestinationEndpoint,
-		SourceEndpoint:      message.SourceEndpoint,
-		ClusterID:           message.ClusterID,
-		TransactionID:       transactionId,
-		Options:             AfDataRequestOptions{ACKRequest: requireAck},
-		Radius:              DefaultRadius,
-		Data:                message.Data,
+	transactionId, err := z.transactionPool.acquire(ctx)
+	if err != nil {
+		return err
 	}
 
+	outcome := transactionAbandoned
+	defer func() { z.transactionPool.release(transactionId, outcome) }()
+
+	send := z.prepareDataRequest(network, message, transactionId, requireAck)
+
 	if requireAck {
-		_, err = z.nodeRequest(ctx, &request, &AfDataRequestReply{}, &AfDataConfirm{}, func(i interface{}) bool {
+		var confirm interface{}
+
+		confirm, err = z.nodeRequestFunc(ctx, send, &AfDataConfirm{}, func(i interface{}) bool {
 			msg := i.(*AfDataConfirm)
 			return msg.TransactionID == transactionId && msg.Endpoint == message.DestinationEndpoint
 		})
-	} else {
-		err = z.requestResponder.RequestResponse(ctx, &request, &AfDataRequestReply{})
+
+		if confirm != nil || errors.Is(err, ErrorZFailure) {
+			outcome = transactionConfirmed
+		}
+	} else if err = send(ctx); err == nil {
+		outcome = transactionUnacknowledged
+	} else if errors.Is(err, ErrorZFailure) {
+		outcome = transactionConfirmed
 	}
 
 	return err
 }
 
+/* Payloads too large for an AfDataRequest may only be sent to a single node, acknowledged, with fragmentation enabled. */
+func (z *ZStack) checkPayloadSize(message zigbee.ApplicationMessage, requireAck bool) error {
+	if len(message.Data) <= afDataRequestInlineLimit {
+		return nil
+	}
+
+	if !z.config.apsFragmentation {
+		return fmt.Errorf("%w: length = %d", ErrPayloadTooLarge, len(message.Data))
+	}
+
+	if !requireAck {
+		return fmt.Errorf("%w: length = %d", ErrFragmentationRequiresAck, len(message.Data))
+	}
+
+	return nil
+}
+
+/*
+Returns a function which sends the data request. Payloads too large for an AfDataRequest are staged with AfDataStore
+and sent as an AfDataRequestExt, which Z-Stack fragments with APS.
+*/
+func (z *ZStack) prepareDataRequest(network zigbee.NetworkAddress, message zigbee.ApplicationMessage, transactionId uint8, requireAck bool) func(context.Context) error {
+	if len(message.Data) <= afDataRequestInlineLimit {
+		request := AfDataRequest{
+			DestinationAddress:  network,
+			DestinationEndpoint: message.DestinationEndpoint,
+			SourceEndpoint:      message.SourceEndpoint,
+			ClusterID:           message.ClusterID,
+			TransactionID:       transactionId,
+			Options:             AfDataRequestOptions{ACKRequest: requireAck},
+			Radius:              z.config.radius,
+			Data:                message.Data,
+		}
+
+		return func(ctx context.Context) error {
+			reply := AfDataRequestReply{}
+
+			if err := z.requestResponder.RequestResponse(ctx, &request, &reply); err != nil {
+				return err
+			}
+
+			if !reply.WasSuccessful() {
+				return statusError(ErrorZFailure, reply)
+			}
+
+			return nil
+		}
+	}
+
+	request := AfDataRequestExt{
+		DestinationAddressMode: AfAddressMode16Bit,
+		DestinationAddress:     uint64(network),
+		DestinationEndpoint:    message.DestinationEndpoint,
+		DestinationPANID:       z.NetworkProperties.PANID,
+		SourceEndpoint:         message.SourceEndpoint,
+		ClusterID:              message.ClusterID,
+		TransactionID:          transactionId,
+		Options:                AfDataRequestOptions{ACKRequest: requireAck},
+		Radius:                 z.config.radius,
+		Data:                   message.Data,
+	}
+
+	return func(ctx context.Context) error {
+		return z.sendStagedDataRequestExt(ctx, request)
+	}
+}
+
 type AfDataRequestOptions struct {
 	Reserved0      uint8 `bcfieldwidth:"1"`
 	EnableSecurity bool  `bcfieldwidth:"1"`
@@ -8,7 +8,6 @@ import (
 	unpiTest "github.com/shimmeringbee/unpi/testing"
 	"github.com/shimmeringbee/zigbee"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/sync/semaphore"
 	"testing"
 	"time"
 )
@@ -21,7 +20,8 @@ func Test_SendNodeMessage(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		defer unpiMock.AssertCalls(t)
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
@@ -59,6 +59,81 @@ func Test_SendNodeMessage(t *testing.T) {
 		assert.Equal(t, []byte{0x00, 0x10, 0x04, 0x03, 0x00, 0x20, 0x00, 0x10, 0x20, 0x02, 0x0a, 0x0b}, sentFrame.Payload)
 	})
 
+	t.Run("messages with ack return the delivery status when not delivered", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		unpiMock.On(SREQ, AF, AfDataRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   AF,
+				CommandID:   AfDataConfirmID,
+				Payload:     []byte{0xe9, 0x04, 0x00},
+			})
+		}()
+
+		appMessage := zigbee.ApplicationMessage{
+			ClusterID:           0x2000,
+			SourceEndpoint:      0x03,
+			DestinationEndpoint: 0x04,
+			Data:                []byte{0x0a, 0x0b},
+		}
+
+		err := zstack.SendApplicationMessageToNode(ctx, zigbee.IEEEAddress(0x1122334455667788), appMessage, true)
+		assert.ErrorIs(t, err, NodeResponseWasNotSuccess)
+		assert.ErrorIs(t, err, ZMacNoAck)
+	})
+
+	t.Run("messages without ack return an error if the adapter rejects the request", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		unpiMock.On(SREQ, AF, AfDataRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestReplyID,
+			Payload:     []byte{0x10},
+		})
+
+		appMessage := zigbee.ApplicationMessage{
+			ClusterID:           0x2000,
+			SourceEndpoint:      0x03,
+			DestinationEndpoint: 0x04,
+			Data:                []byte{0x0a, 0x0b},
+		}
+
+		err := zstack.SendApplicationMessageToNode(ctx, zigbee.IEEEAddress(0x1122334455667788), appMessage, false)
+		assert.ErrorIs(t, err, ErrorZFailure)
+		assert.ErrorIs(t, err, ZMemError)
+	})
+
 	t.Run("messages without ack just return", func(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 		defer cancel()
@@ -66,7 +141,8 @@ func Test_SendNodeMessage(t *testing.T) {
 		unpiMock := unpiTest.NewMockAdapter()
 		defer unpiMock.AssertCalls(t)
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
@@ -92,6 +168,299 @@ func Test_SendNodeMessage(t *testing.T) {
 
 		assert.Equal(t, []byte{0x00, 0x10, 0x04, 0x03, 0x00, 0x20, 0x00, 0x0, 0x20, 0x02, 0x0a, 0x0b}, sentFrame.Payload)
 	})
+
+	t.Run("large messages are rejected without aps fragmentation", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		appMessage := zigbee.ApplicationMessage{
+			ClusterID:           0x2000,
+			SourceEndpoint:      0x03,
+			DestinationEndpoint: 0x04,
+			Data:                make([]byte, 300),
+		}
+
+		err := zstack.SendApplicationMessageToNode(ctx, zigbee.IEEEAddress(0x1122334455667788), appMessage, false)
+		assert.ErrorIs(t, err, ErrPayloadTooLarge)
+	})
+
+	t.Run("large messages are staged with data store and sent with ack", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New(), WithAPSFragmentation())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		zstack.NetworkProperties.PANID = 0x1234
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		ext := unpiMock.On(SREQ, AF, AfDataRequestExtID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestExtReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		store := unpiMock.On(SREQ, AF, AfDataStoreID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataStoreReplyID,
+			Payload:     []byte{0x00},
+		}).Times(3)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   AF,
+				CommandID:   AfDataConfirmID,
+				Payload:     []byte{0x00, 0x04, 0x00},
+			})
+		}()
+
+		data := make([]byte, 300)
+		for i := range data {
+			data[i] = byte(i)
+		}
+
+		appMessage := zigbee.ApplicationMessage{
+			ClusterID:           0x2000,
+			SourceEndpoint:      0x03,
+			DestinationEndpoint: 0x04,
+			Data:                data,
+		}
+
+		err := zstack.SendApplicationMessageToNode(ctx, zigbee.IEEEAddress(0x1122334455667788), appMessage, true)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []byte{0x02, 0x00, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x34, 0x12, 0x03, 0x00, 0x20, 0x00, 0x10, 0x20, 0x2c, 0x01}, ext.CapturedCalls[0].Frame.Payload)
+
+		first := store.CapturedCalls[0].Frame.Payload
+		assert.Equal(t, []byte{0x00, 0x00, byte(afDataStoreChunkSize)}, first[:3])
+		assert.Equal(t, data[:afDataStoreChunkSize], first[3:])
+
+		second := store.CapturedCalls[1].Frame.Payload
+		assert.Equal(t, []byte{byte(afDataStoreChunkSize), 0x00, byte(300 - afDataStoreChunkSize)}, second[:3])
+		assert.Equal(t, data[afDataStoreChunkSize:], second[3:])
+
+		assert.Equal(t, []byte{0x2c, 0x01, 0x00}, store.CapturedCalls[2].Frame.Payload)
+	})
+
+	t.Run("large messages without ack are rejected", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New(), WithAPSFragmentation())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		appMessage := zigbee.ApplicationMessage{
+			ClusterID:           0x2000,
+			SourceEndpoint:      0x03,
+			DestinationEndpoint: 0x04,
+			Data:                make([]byte, afDataRequestInlineLimit+1),
+		}
+
+		err := zstack.SendApplicationMessageToNode(ctx, zigbee.IEEEAddress(0x1122334455667788), appMessage, false)
+		assert.ErrorIs(t, err, ErrFragmentationRequiresAck)
+	})
+
+	t.Run("messages which fit an AfDataRequest are sent without fragmentation or acknowledgement", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		c := unpiMock.On(SREQ, AF, AfDataRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		appMessage := zigbee.ApplicationMessage{
+			ClusterID:           0x2000,
+			SourceEndpoint:      0x03,
+			DestinationEndpoint: 0x04,
+			Data:                make([]byte, afDataRequestInlineLimit),
+		}
+
+		err := zstack.SendApplicationMessageToNode(ctx, zigbee.IEEEAddress(0x1122334455667788), appMessage, false)
+		assert.NoError(t, err)
+
+		sentFrame := c.CapturedCalls[0].Frame
+		assert.Equal(t, byte(afDataRequestInlineLimit), sentFrame.Payload[9])
+		assert.Len(t, sentFrame.Payload, 10+afDataRequestInlineLimit)
+	})
+
+	t.Run("staging waits for any other staged message to be sent", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New(), WithAPSFragmentation())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		ext := unpiMock.On(SREQ, AF, AfDataRequestExtID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestExtReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		unpiMock.On(SREQ, AF, AfDataStoreID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataStoreReplyID,
+			Payload:     []byte{0x00},
+		}).Times(3)
+
+		zstack.dataStoreSlot <- struct{}{}
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			<-zstack.dataStoreSlot
+
+			time.Sleep(10 * time.Millisecond)
+
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   AF,
+				CommandID:   AfDataConfirmID,
+				Payload:     []byte{0x00, 0x04, 0x00},
+			})
+		}()
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			assert.Empty(t, ext.CapturedCalls)
+		}()
+
+		appMessage := zigbee.ApplicationMessage{
+			ClusterID:           0x2000,
+			SourceEndpoint:      0x03,
+			DestinationEndpoint: 0x04,
+			Data:                make([]byte, 300),
+		}
+
+		err := zstack.SendApplicationMessageToNode(ctx, zigbee.IEEEAddress(0x1122334455667788), appMessage, true)
+		assert.NoError(t, err)
+		assert.Len(t, ext.CapturedCalls, 1)
+	})
+
+	t.Run("the staging slot is released once the final store is accepted, before the confirm", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New(), WithAPSFragmentation())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		unpiMock.On(SREQ, AF, AfDataRequestExtID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestExtReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		unpiMock.On(SREQ, AF, AfDataStoreID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataStoreReplyID,
+			Payload:     []byte{0x00},
+		}).Times(3)
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+
+			select {
+			case zstack.dataStoreSlot <- struct{}{}:
+				<-zstack.dataStoreSlot
+			default:
+				assert.Fail(t, "staging slot held while waiting for confirm")
+			}
+
+			unpiMock.InjectOutgoing(Frame{
+				MessageType: AREQ,
+				Subsystem:   AF,
+				CommandID:   AfDataConfirmID,
+				Payload:     []byte{0x00, 0x04, 0x00},
+			})
+		}()
+
+		appMessage := zigbee.ApplicationMessage{
+			ClusterID:           0x2000,
+			SourceEndpoint:      0x03,
+			DestinationEndpoint: 0x04,
+			Data:                make([]byte, 300),
+		}
+
+		err := zstack.SendApplicationMessageToNode(ctx, zigbee.IEEEAddress(0x1122334455667788), appMessage, true)
+		assert.NoError(t, err)
+	})
+
+	t.Run("waiting for the staging slot honours the context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New(), WithAPSFragmentation())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(zigbee.IEEEAddress(0x1122334455667788), zigbee.NetworkAddress(0x1000))
+
+		zstack.dataStoreSlot <- struct{}{}
+		defer func() { <-zstack.dataStoreSlot }()
+
+		appMessage := zigbee.ApplicationMessage{
+			ClusterID:           0x2000,
+			SourceEndpoint:      0x03,
+			DestinationEndpoint: 0x04,
+			Data:                make([]byte, 300),
+		}
+
+		err := zstack.SendApplicationMessageToNode(ctx, zigbee.IEEEAddress(0x1122334455667788), appMessage, true)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
 }
 
 func Test_SendMessages(t *testing.T) {
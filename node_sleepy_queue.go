@@ -0,0 +1,243 @@
+package zstack
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/logwrap"
+	"github.com/shimmeringbee/zigbee"
+	"sync"
+	"time"
+)
+
+const DefaultSleepyMessageTTL = 5 * time.Minute
+
+var ErrMessageQueued = errors.New("message queued until sleepy end device is next heard from")
+
+const (
+	neighbourRxOffWhenIdle uint8 = 0x00
+	neighbourRxOnWhenIdle  uint8 = 0x01
+)
+
+/*
+Holds messages destined for end devices that do not keep their receiver on when idle, releasing them when the device is
+next heard from. ZNP does not report data polls to the host, so incoming messages and announcements are used instead.
+*/
+func WithSleepyDeviceQueue(ttl time.Duration) Option {
+	return func(o *options) {
+		o.sleepyMessageTTL = ttl
+	}
+}
+
+type QueuedMessageExpiredEvent struct {
+	IEEEAddress zigbee.IEEEAddress
+	Message     zigbee.ApplicationMessage
+	QueuedAt    time.Time
+}
+
+type QueuedMessageFailedEvent struct {
+	IEEEAddress zigbee.IEEEAddress
+	Message     zigbee.ApplicationMessage
+	QueuedAt    time.Time
+	Err         error
+}
+
+type queuedMessage struct {
+	message    zigbee.ApplicationMessage
+	requireAck bool
+	queuedAt   time.Time
+	expires    time.Time
+}
+
+type sleepyQueue struct {
+	lock    sync.Mutex
+	sleepy  map[zigbee.IEEEAddress]bool
+	queues  map[zigbee.IEEEAddress][]queuedMessage
+	timers  map[*time.Timer]struct{}
+	stopped bool
+}
+
+func newSleepyQueue() *sleepyQueue {
+	return &sleepyQueue{
+		sleepy: map[zigbee.IEEEAddress]bool{},
+		queues: map[zigbee.IEEEAddress][]queuedMessage{},
+		timers: map[*time.Timer]struct{}{},
+	}
+}
+
+func (q *sleepyQueue) scheduleExpiry(after time.Duration, f func()) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.stopped {
+		return
+	}
+
+	var timer *time.Timer
+
+	timer = time.AfterFunc(after, func() {
+		q.lock.Lock()
+		delete(q.timers, timer)
+		q.lock.Unlock()
+
+		f()
+	})
+
+	q.timers[timer] = struct{}{}
+}
+
+func (q *sleepyQueue) stopTimers() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.stopped = true
+
+	for timer := range q.timers {
+		timer.Stop()
+	}
+
+	clear(q.timers)
+}
+
+func (q *sleepyQueue) setSleepy(ieee zigbee.IEEEAddress, sleepy bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.sleepy[ieee] = sleepy
+}
+
+func (q *sleepyQueue) isSleepy(ieee zigbee.IEEEAddress) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.sleepy[ieee]
+}
+
+func (q *sleepyQueue) enqueue(ieee zigbee.IEEEAddress, msg queuedMessage) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.queues[ieee] = append(q.queues[ieee], msg)
+}
+
+func (q *sleepyQueue) take(ieee zigbee.IEEEAddress) []queuedMessage {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	msgs := q.queues[ieee]
+	delete(q.queues, ieee)
+
+	return msgs
+}
+
+func (q *sleepyQueue) remove(ieee zigbee.IEEEAddress) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	delete(q.queues, ieee)
+	delete(q.sleepy, ieee)
+}
+
+func (q *sleepyQueue) takeExpired(now time.Time) map[zigbee.IEEEAddress][]queuedMessage {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	expired := map[zigbee.IEEEAddress][]queuedMessage{}
+
+	for ieee, msgs := range q.queues {
+		var remaining []queuedMessage
+
+		for _, msg := range msgs {
+			if msg.expires.After(now) {
+				remaining = append(remaining, msg)
+			} else {
+				expired[ieee] = append(expired[ieee], msg)
+			}
+		}
+
+		if len(remaining) > 0 {
+			q.queues[ieee] = remaining
+		} else {
+			delete(q.queues, ieee)
+		}
+	}
+
+	return expired
+}
+
+func (z *ZStack) shouldQueueForNode(ieee zigbee.IEEEAddress) bool {
+	if z.config.sleepyMessageTTL <= 0 {
+		return false
+	}
+
+	node, found := z.nodeTable.getByIEEE(ieee)
+	return found && node.LogicalType == zigbee.EndDevice && z.sleepyQueue.isSleepy(ieee)
+}
+
+func (z *ZStack) queueMessageForNode(ctx context.Context, ieee zigbee.IEEEAddress, message zigbee.ApplicationMessage, requireAck bool) {
+	now := time.Now()
+
+	z.sleepyQueue.enqueue(ieee, queuedMessage{
+		message:    message,
+		requireAck: requireAck,
+		queuedAt:   now,
+		expires:    now.Add(z.config.sleepyMessageTTL),
+	})
+
+	z.logger.LogDebug(ctx, "Queued application message for sleepy end device.", logwrap.Datum("IEEEAddress", ieee.String()), logwrap.Datum("ClusterID", message.ClusterID))
+
+	z.sleepyQueue.scheduleExpiry(z.config.sleepyMessageTTL, func() { z.goBackground(z.expireQueuedMessages) })
+}
+
+func (z *ZStack) expireQueuedMessages() {
+	if z.ctx.Err() != nil {
+		return
+	}
+
+	for ieee, msgs := range z.sleepyQueue.takeExpired(time.Now()) {
+		for _, msg := range msgs {
+			z.logger.LogWarn(z.ctx, "Queued application message for sleepy end device expired.", logwrap.Datum("IEEEAddress", ieee.String()), logwrap.Datum("ClusterID", msg.message.ClusterID))
+			z.sendEvent(QueuedMessageExpiredEvent{IEEEAddress: ieee, Message: msg.message, QueuedAt: msg.queuedAt})
+		}
+	}
+}
+
+func (z *ZStack) releaseQueuedMessages(ieee zigbee.IEEEAddress) {
+	msgs := z.sleepyQueue.take(ieee)
+	if len(msgs) == 0 {
+		return
+	}
+
+	z.goBackground(func() {
+		node, found := z.nodeTable.getByIEEE(ieee)
+		if !found {
+			return
+		}
+
+		now := time.Now()
+
+		for _, msg := range msgs {
+			if !msg.expires.After(now) {
+				z.sendEvent(QueuedMessageExpiredEvent{IEEEAddress: ieee, Message: msg.message, QueuedAt: msg.queuedAt})
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(z.ctx, z.releaseTimeout())
+			err := z.sendApplicationMessageToNode(ctx, ieee, node.NetworkAddress, msg.message, msg.requireAck)
+			cancel()
+
+			if err != nil {
+				z.logger.LogError(z.ctx, "Failed to release queued application message to sleepy end device.", logwrap.Datum("IEEEAddress", ieee.String()), logwrap.Datum("ClusterID", msg.message.ClusterID), logwrap.Err(err))
+				z.sendEvent(QueuedMessageFailedEvent{IEEEAddress: ieee, Message: msg.message, QueuedAt: msg.queuedAt, Err: err})
+			}
+		}
+	})
+}
+
+/* Released messages follow the delivery policy, so each attempt and its backoff must fit within the timeout. */
+func (z *ZStack) releaseTimeout() time.Duration {
+	if policy := z.config.deliveryPolicy; policy != nil && policy.Attempts > 1 {
+		return time.Duration(policy.Attempts) * (z.config.timeout + policy.MaxBackoff)
+	}
+
+	return z.config.timeout
+}
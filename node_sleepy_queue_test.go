@@ -0,0 +1,177 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_SleepyDeviceQueue(t *testing.T) {
+	ieee := zigbee.IEEEAddress(0x1122334455667788)
+
+	appMessage := zigbee.ApplicationMessage{
+		ClusterID:           0x2000,
+		SourceEndpoint:      0x03,
+		DestinationEndpoint: 0x04,
+		Data:                []byte{0x0a, 0x0b},
+	}
+
+	t.Run("messages to sleepy end devices are held until the device announces", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New(), WithSleepyDeviceQueue(time.Minute))
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(ieee, zigbee.NetworkAddress(0x1000), logicalType(zigbee.EndDevice))
+		zstack.sleepyQueue.setSleepy(ieee, true)
+
+		c := unpiMock.On(SREQ, AF, AfDataRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		err := zstack.SendApplicationMessageToNode(ctx, ieee, appMessage, false)
+		assert.NoError(t, err)
+
+		time.Sleep(10 * time.Millisecond)
+		assert.Empty(t, c.CapturedCalls)
+
+		zstack.newNode(ZdoEndDeviceAnnceInd{IEEEAddress: ieee, NetworkAddress: 0x2000})
+
+		assert.Eventually(t, func() bool {
+			return len(c.CapturedCalls) == 1
+		}, 100*time.Millisecond, 5*time.Millisecond)
+
+		unpiMock.AssertCalls(t)
+	})
+
+	t.Run("messages to end devices that are receive on idle are sent immediately", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New(), WithSleepyDeviceQueue(time.Minute))
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(ieee, zigbee.NetworkAddress(0x1000), logicalType(zigbee.EndDevice))
+		zstack.sleepyQueue.setSleepy(ieee, false)
+
+		unpiMock.On(SREQ, AF, AfDataRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestReplyID,
+			Payload:     []byte{0x00},
+		})
+
+		err := zstack.SendApplicationMessageToNode(ctx, ieee, appMessage, false)
+		assert.NoError(t, err)
+	})
+
+	t.Run("expired messages are discarded and raise an event", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New(), WithSleepyDeviceQueue(20*time.Millisecond))
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		sub := zstack.Subscribe(1, OverflowDropNewest, FilterEventType(QueuedMessageExpiredEvent{}))
+
+		zstack.nodeTable.addOrUpdate(ieee, zigbee.NetworkAddress(0x1000), logicalType(zigbee.EndDevice))
+		zstack.sleepyQueue.setSleepy(ieee, true)
+
+		err := zstack.SendApplicationMessageToNode(ctx, ieee, appMessage, true)
+		assert.ErrorIs(t, err, ErrMessageQueued)
+
+		event, err := sub.ReadEvent(ctx)
+		assert.NoError(t, err)
+
+		expired, ok := event.(QueuedMessageExpiredEvent)
+		assert.True(t, ok)
+		assert.Equal(t, ieee, expired.IEEEAddress)
+		assert.Equal(t, appMessage, expired.Message)
+
+		assert.Empty(t, zstack.sleepyQueue.take(ieee))
+	})
+
+	t.Run("released messages that fail to send raise an event", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New(), WithSleepyDeviceQueue(time.Minute))
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		sub := zstack.Subscribe(1, OverflowDropNewest, FilterEventType(QueuedMessageFailedEvent{}))
+
+		zstack.nodeTable.addOrUpdate(ieee, zigbee.NetworkAddress(0x1000), logicalType(zigbee.EndDevice))
+		zstack.sleepyQueue.setSleepy(ieee, true)
+
+		unpiMock.On(SREQ, AF, AfDataRequestID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   AF,
+			CommandID:   AfDataRequestReplyID,
+			Payload:     []byte{0x10},
+		})
+
+		err := zstack.SendApplicationMessageToNode(ctx, ieee, appMessage, false)
+		assert.NoError(t, err)
+
+		zstack.newNode(ZdoEndDeviceAnnceInd{IEEEAddress: ieee, NetworkAddress: 0x2000})
+
+		event, err := sub.ReadEvent(ctx)
+		assert.NoError(t, err)
+
+		failed, ok := event.(QueuedMessageFailedEvent)
+		assert.True(t, ok)
+		assert.Equal(t, ieee, failed.IEEEAddress)
+		assert.Equal(t, appMessage, failed.Message)
+		assert.ErrorIs(t, failed.Err, ZMemError)
+	})
+
+	t.Run("pending expiry timers are stopped when the adapter stops", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New(), WithSleepyDeviceQueue(time.Minute))
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		zstack.nodeTable.addOrUpdate(ieee, zigbee.NetworkAddress(0x1000), logicalType(zigbee.EndDevice))
+		zstack.sleepyQueue.setSleepy(ieee, true)
+
+		err := zstack.SendApplicationMessageToNode(ctx, ieee, appMessage, false)
+		assert.NoError(t, err)
+		assert.Len(t, zstack.sleepyQueue.timers, 1)
+
+		err = zstack.Stop(ctx)
+		assert.NoError(t, err)
+		assert.Empty(t, zstack.sleepyQueue.timers)
+
+		zstack.sleepyQueue.scheduleExpiry(time.Minute, func() {})
+		assert.Empty(t, zstack.sleepyQueue.timers)
+	})
+}
@@ -8,7 +8,6 @@ import (
 	unpiTest "github.com/shimmeringbee/unpi/testing"
 	"github.com/shimmeringbee/zigbee"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/sync/semaphore"
 	"testing"
 	"time"
 )
@@ -20,7 +19,8 @@ func Test_UnbindToNode(t *testing.T) {
 
 		unpiMock := unpiTest.NewMockAdapter()
 		zstack := New(unpiMock, memory.New())
-		zstack.sem = semaphore.NewWeighted(8)
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
 		defer unpiMock.Stop()
 
 		call := unpiMock.On(SREQ, ZDO, ZdoUnbindReqReplyID).Return(Frame{
@@ -58,6 +58,28 @@ func Test_UnbindToNode(t *testing.T) {
 
 		unpiMock.AssertCalls(t)
 	})
+
+	t.Run("returns an error if the network address can not be resolved", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unpiMock := unpiTest.NewMockAdapter()
+		defer unpiMock.AssertCalls(t)
+		zstack := New(unpiMock, memory.New())
+		zstack.scheduler.setCapacity(8)
+		zstack.state = Running
+		defer unpiMock.Stop()
+
+		unpiMock.On(SREQ, ZDO, ZdoNWKAddrReqID).Return(Frame{
+			MessageType: SRSP,
+			Subsystem:   ZDO,
+			CommandID:   ZdoNWKAddrReqReplyID,
+			Payload:     []byte{0x01},
+		})
+
+		err := zstack.UnbindNodeFromController(ctx, zigbee.IEEEAddress(0x1122334455667788), 0x01, 0x02, 0x0006)
+		assert.ErrorIs(t, err, ErrorZFailure)
+	})
 }
 
 func Test_UnbindMessages(t *testing.T) {
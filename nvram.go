@@ -19,6 +19,10 @@ func (z *ZStack) writeNVRAM(ctx context.Context, v interface{}) error {
 		return NVRAMUnrecognised
 	}
 
+	return z.writeNVRAMByID(ctx, configId, v)
+}
+
+func (z *ZStack) writeNVRAMByID(ctx context.Context, configId uint16, v interface{}) error {
 	configValue, err := bytecodec.Marshal(v)
 	if err != nil {
 		return err
@@ -37,7 +41,7 @@ func (z *ZStack) writeNVRAM(ctx context.Context, v interface{}) error {
 	}
 
 	if writeResponse.Status != ZSuccess {
-		return fmt.Errorf("%w: write: configId = %v, status = %v", NVRAMUnsuccessful, configId, writeResponse.Status)
+		return fmt.Errorf("write: configId = %v: %w", configId, ZStackStatusError{Err: NVRAMUnsuccessful, Status: writeResponse.Status})
 	}
 
 	return nil
@@ -56,6 +60,10 @@ func (z *ZStack) readNVRAM(ctx context.Context, v interface{}) error {
 		return NVRAMUnrecognised
 	}
 
+	return z.readNVRAMByID(ctx, configId, v)
+}
+
+func (z *ZStack) readNVRAMByID(ctx context.Context, configId uint16, v interface{}) error {
 	readRequest := SysOSALNVRead{
 		NVItemID: configId,
 		Offset:   0,
@@ -68,12 +76,41 @@ func (z *ZStack) readNVRAM(ctx context.Context, v interface{}) error {
 	}
 
 	if readResponse.Status != ZSuccess {
-		return fmt.Errorf("%w: read: configId = %v, status = %v", NVRAMUnsuccessful, configId, readResponse.Status)
+		return fmt.Errorf("read: configId = %v: %w", configId, ZStackStatusError{Err: NVRAMUnsuccessful, Status: readResponse.Status})
 	}
 
 	return bytecodec.Unmarshal(readResponse.Value, v)
 }
 
+func (z *ZStack) deleteNVRAMByID(ctx context.Context, configId uint16) error {
+	lengthResponse := SysOSALNVLengthReply{}
+
+	if err := z.requestResponder.RequestResponse(ctx, SysOSALNVLength{NVItemID: configId}, &lengthResponse); err != nil {
+		return err
+	}
+
+	if lengthResponse.Length == 0 {
+		return nil
+	}
+
+	deleteRequest := SysOSALNVDelete{
+		NVItemID: configId,
+		Length:   lengthResponse.Length,
+	}
+
+	deleteResponse := SysOSALNVDeleteReply{}
+
+	if err := z.requestResponder.RequestResponse(ctx, deleteRequest, &deleteResponse); err != nil {
+		return err
+	}
+
+	if deleteResponse.Status != ZSuccess {
+		return fmt.Errorf("delete: configId = %v: %w", configId, ZStackStatusError{Err: NVRAMUnsuccessful, Status: deleteResponse.Status})
+	}
+
+	return nil
+}
+
 type SysOSALNVWrite struct {
 	NVItemID uint16
 	Offset   uint8
@@ -100,6 +137,29 @@ type SysOSALNVReadReply struct {
 
 const SysOSALNVReadReplyID uint8 = 0x08
 
+type SysOSALNVDelete struct {
+	NVItemID uint16
+	Length   uint16
+}
+
+const SysOSALNVDeleteID uint8 = 0x12
+
+type SysOSALNVDeleteReply GenericZStackStatus
+
+const SysOSALNVDeleteReplyID uint8 = 0x12
+
+type SysOSALNVLength struct {
+	NVItemID uint16
+}
+
+const SysOSALNVLengthID uint8 = 0x13
+
+type SysOSALNVLengthReply struct {
+	Length uint16
+}
+
+const SysOSALNVLengthReplyID uint8 = 0x13
+
 var nvramStructToID = map[reflect.Type]uint16{
 	reflect.TypeOf(ZCDNVStartUpOption{}):    ZCDNVStartUpOptionID,
 	reflect.TypeOf(ZCDNVLogicalType{}):      ZCDNVLogicalTypeID,
@@ -112,6 +172,11 @@ var nvramStructToID = map[reflect.Type]uint16{
 	reflect.TypeOf(ZCDNVExtPANID{}):         ZCDNVExtPANIDID,
 	reflect.TypeOf(ZCDNVUseDefaultTCLK{}):   ZCDNVUseDefaultTCLKID,
 	reflect.TypeOf(ZCDNVTCLKTableStart{}):   ZCDNVTCLKTableStartID,
+	reflect.TypeOf(ZCDNVExtAddr{}):          ZCDNVExtAddrID,
+	reflect.TypeOf(ZCDNVNwkActiveKeyInfo{}): ZCDNVNwkActiveKeyInfoID,
+	reflect.TypeOf(ZCDNVNwkKey{}):           ZCDNVNwkKeyID,
+	reflect.TypeOf(ZCDNVNwkSecMaterial{}):   ZCDNVNwkSecMaterialTableStartID,
+	reflect.TypeOf(ZCDNVTCLKSeed{}):         ZCDNVTCLKSeedID,
 }
 
 const ZCDNVStartUpOptionID uint16 = 0x0003
@@ -182,3 +247,66 @@ type ZCDNVTCLKTableStart struct {
 	TXFrameCounter uint32
 	RXFrameCounter uint32
 }
+
+const ZCDNVTCLKTableEndID uint16 = 0x01ff
+
+const ZCDNVExtAddrID uint16 = 0x0001
+
+type ZCDNVExtAddr struct {
+	IEEEAddress zigbee.IEEEAddress
+}
+
+const ZCDNVNwkActiveKeyInfoID uint16 = 0x003a
+
+type ZCDNVNwkActiveKeyInfo struct {
+	KeySeqNum uint8
+	Key       zigbee.NetworkKey
+}
+
+const ZCDNVNwkKeyID uint16 = 0x0082
+
+type ZCDNVNwkKey struct {
+	KeySeqNum    uint8
+	Key          zigbee.NetworkKey
+	FrameCounter uint32
+}
+
+const (
+	ZCDNVNwkSecMaterialTableStartID uint16 = 0x0075
+	ZCDNVNwkSecMaterialTableEndID   uint16 = 0x0080
+)
+
+type ZCDNVNwkSecMaterial struct {
+	FrameCounter  uint32
+	ExtendedPANID zigbee.ExtendedPANID
+}
+
+/* Z-Stack 3.X.X reuses the first legacy TCLK table item to store the seed used to derive unique link keys. */
+const ZCDNVTCLKSeedID uint16 = 0x0101
+
+type ZCDNVTCLKSeed struct {
+	Key zigbee.NetworkKey
+}
+
+/* Z-Stack 3.0.X stores its TCLK table in legacy items following the seed and install code entries. */
+const ZCDNVTCLKTableStartV30ID uint16 = 0x0111
+
+/* Z-Stack 3.X.0 stores its TCLK table in the extended NV API. */
+const ZCDNVExTCLKTableID uint16 = 0x0004
+
+const TCLKKeyAttributesVerified uint8 = 0x02
+
+/* Z-Stack 3.X.X TCLK entries do not hold a key, it is derived from the seed shifted by SeedShift. */
+type ZCDNVTCLKDevEntry struct {
+	TXFrameCounter uint32
+	RXFrameCounter uint32
+	Address        zigbee.IEEEAddress
+	KeyAttributes  uint8
+	KeyType        uint8
+	SeedShift      uint8
+}
+
+const (
+	ZCDNVNIBID                 uint16 = 0x0021
+	ZCDNVBDBNodeIsOnANetworkID uint16 = 0x004e
+)
@@ -0,0 +1,127 @@
+package zstack
+
+import (
+	"context"
+	"fmt"
+	"github.com/shimmeringbee/bytecodec"
+	"reflect"
+)
+
+/* Z-Stack 3.X.0 stores tables in the extended NV API, items are addressed by system, item and sub item. */
+const NVSysIDZStack uint8 = 0x01
+
+func (z *ZStack) readExtendedNVRAM(ctx context.Context, sysID uint8, itemID uint16, subID uint16, v interface{}) error {
+	size, err := bytecodec.Marshal(reflect.ValueOf(v).Elem().Interface())
+	if err != nil {
+		return err
+	}
+
+	readRequest := SysNVRead{
+		SysID:  sysID,
+		ItemID: itemID,
+		SubID:  subID,
+		Offset: 0,
+		Length: uint8(len(size)),
+	}
+
+	readResponse := SysNVReadReply{}
+
+	if err := z.requestResponder.RequestResponse(ctx, readRequest, &readResponse); err != nil {
+		return err
+	}
+
+	if readResponse.Status != ZSuccess {
+		return fmt.Errorf("read: sysId = %v, itemId = %v, subId = %v: %w", sysID, itemID, subID, ZStackStatusError{Err: NVRAMUnsuccessful, Status: readResponse.Status})
+	}
+
+	return bytecodec.Unmarshal(readResponse.Value, v)
+}
+
+func (z *ZStack) writeExtendedNVRAM(ctx context.Context, sysID uint8, itemID uint16, subID uint16, v interface{}) error {
+	value, err := bytecodec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	createRequest := SysNVCreate{
+		SysID:  sysID,
+		ItemID: itemID,
+		SubID:  subID,
+		Length: uint32(len(value)),
+	}
+
+	createResponse := SysNVCreateReply{}
+
+	if err := z.requestResponder.RequestResponse(ctx, createRequest, &createResponse); err != nil {
+		return err
+	}
+
+	/* Create reports NV_ITEM_UNINIT when the item did not previously exist. */
+	if createResponse.Status != ZSuccess && createResponse.Status != ZNVItemUninit {
+		return fmt.Errorf("create: sysId = %v, itemId = %v, subId = %v: %w", sysID, itemID, subID, ZStackStatusError{Err: NVRAMUnsuccessful, Status: createResponse.Status})
+	}
+
+	writeRequest := SysNVWrite{
+		SysID:  sysID,
+		ItemID: itemID,
+		SubID:  subID,
+		Offset: 0,
+		Value:  value,
+	}
+
+	writeResponse := SysNVWriteReply{}
+
+	if err := z.requestResponder.RequestResponse(ctx, writeRequest, &writeResponse); err != nil {
+		return err
+	}
+
+	if writeResponse.Status != ZSuccess {
+		return fmt.Errorf("write: sysId = %v, itemId = %v, subId = %v: %w", sysID, itemID, subID, ZStackStatusError{Err: NVRAMUnsuccessful, Status: writeResponse.Status})
+	}
+
+	return nil
+}
+
+type SysNVCreate struct {
+	SysID  uint8
+	ItemID uint16
+	SubID  uint16
+	Length uint32
+}
+
+const SysNVCreateID uint8 = 0x30
+
+type SysNVCreateReply GenericZStackStatus
+
+const SysNVCreateReplyID uint8 = 0x30
+
+type SysNVRead struct {
+	SysID  uint8
+	ItemID uint16
+	SubID  uint16
+	Offset uint16
+	Length uint8
+}
+
+const SysNVReadID uint8 = 0x33
+
+type SysNVReadReply struct {
+	Status ZStackStatus
+	Value  []byte `bcsliceprefix:"8"`
+}
+
+const SysNVReadReplyID uint8 = 0x33
+
+type SysNVWrite struct {
+	SysID  uint8
+	ItemID uint16
+	SubID  uint16
+	Offset uint16
+	Value  []byte `bcsliceprefix:"8"`
+}
+
+const SysNVWriteID uint8 = 0x34
+
+type SysNVWriteReply GenericZStackStatus
+
+const SysNVWriteReplyID uint8 = 0x34
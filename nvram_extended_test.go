@@ -0,0 +1,89 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/bytecodec"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func Test_readExtendedNVRAM(t *testing.T) {
+	t.Run("reads an item by system, item and sub item id", func(t *testing.T) {
+		mrr := new(MockRequestResponder)
+		defer mrr.AssertExpectations(t)
+
+		z := ZStack{requestResponder: mrr}
+
+		expected := ZCDNVTCLKDevEntry{Address: zigbee.IEEEAddress(0x1122334455667788), SeedShift: 3}
+		value, _ := bytecodec.Marshal(expected)
+
+		mrr.On("RequestResponse", mock.Anything, SysNVRead{SysID: NVSysIDZStack, ItemID: ZCDNVExTCLKTableID, SubID: 2, Length: uint8(len(value))}, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			reply := args.Get(2).(*SysNVReadReply)
+			reply.Status = ZSuccess
+			reply.Value = value
+		})
+
+		actual := ZCDNVTCLKDevEntry{}
+		err := z.readExtendedNVRAM(context.Background(), NVSysIDZStack, ZCDNVExTCLKTableID, 2, &actual)
+
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("returns an error if the read was unsuccessful", func(t *testing.T) {
+		mrr := new(MockRequestResponder)
+		defer mrr.AssertExpectations(t)
+
+		z := ZStack{requestResponder: mrr}
+
+		mrr.On("RequestResponse", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			reply := args.Get(2).(*SysNVReadReply)
+			reply.Status = ZFailure
+		})
+
+		err := z.readExtendedNVRAM(context.Background(), NVSysIDZStack, ZCDNVExTCLKTableID, 0, &ZCDNVTCLKDevEntry{})
+		assert.ErrorIs(t, err, NVRAMUnsuccessful)
+	})
+}
+
+func Test_writeExtendedNVRAM(t *testing.T) {
+	t.Run("creates the item before writing it", func(t *testing.T) {
+		mrr := new(MockRequestResponder)
+		defer mrr.AssertExpectations(t)
+
+		z := ZStack{requestResponder: mrr}
+
+		entry := ZCDNVTCLKDevEntry{Address: zigbee.IEEEAddress(0x1122334455667788)}
+		value, _ := bytecodec.Marshal(entry)
+
+		mrr.On("RequestResponse", mock.Anything, SysNVCreate{SysID: NVSysIDZStack, ItemID: ZCDNVExTCLKTableID, SubID: 1, Length: uint32(len(value))}, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			reply := args.Get(2).(*SysNVCreateReply)
+			reply.Status = ZSuccess
+		})
+
+		mrr.On("RequestResponse", mock.Anything, SysNVWrite{SysID: NVSysIDZStack, ItemID: ZCDNVExTCLKTableID, SubID: 1, Value: value}, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			reply := args.Get(2).(*SysNVWriteReply)
+			reply.Status = ZSuccess
+		})
+
+		err := z.writeExtendedNVRAM(context.Background(), NVSysIDZStack, ZCDNVExTCLKTableID, 1, entry)
+		assert.NoError(t, err)
+	})
+
+	t.Run("returns an error if the item could not be created", func(t *testing.T) {
+		mrr := new(MockRequestResponder)
+		defer mrr.AssertExpectations(t)
+
+		z := ZStack{requestResponder: mrr}
+
+		mrr.On("RequestResponse", mock.Anything, mock.AnythingOfType("SysNVCreate"), mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			reply := args.Get(2).(*SysNVCreateReply)
+			reply.Status = ZFailure
+		})
+
+		err := z.writeExtendedNVRAM(context.Background(), NVSysIDZStack, ZCDNVExTCLKTableID, 0, ZCDNVTCLKDevEntry{})
+		assert.ErrorIs(t, err, NVRAMUnsuccessful)
+	})
+}
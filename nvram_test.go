@@ -105,7 +105,8 @@ func Test_writeNVRAM(t *testing.T) {
 
 		err := z.writeNVRAM(ctx, ZCDNVLogicalType{LogicalType: zigbee.EndDevice})
 
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, NVRAMUnsuccessful)
+		assert.ErrorIs(t, err, ZFailure)
 	})
 
 	t.Run("verifies that a request response with errors is raised", func(t *testing.T) {
@@ -333,3 +334,89 @@ func Test_NVRAMStructs(t *testing.T) {
 		assert.Equal(t, expectedBytes, actualBytes)
 	})
 }
+
+func Test_NVRAMBackupStructs(t *testing.T) {
+	t.Run("ZCDNVNwkKey", func(t *testing.T) {
+		s := ZCDNVNwkKey{
+			KeySeqNum:    0x01,
+			Key:          [16]byte{0x00, 0x01, 0x02, 0x03, 0x00, 0x01, 0x02, 0x03, 0x00, 0x01, 0x02, 0x03, 0x00, 0x01, 0x02, 0x03},
+			FrameCounter: 0x01020304,
+		}
+
+		actualBytes, err := bytecodec.Marshal(s)
+
+		expectedBytes := []byte{0x01, 0x00, 0x01, 0x02, 0x03, 0x00, 0x01, 0x02, 0x03, 0x00, 0x01, 0x02, 0x03, 0x00, 0x01, 0x02, 0x03, 0x04, 0x03, 0x02, 0x01}
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedBytes, actualBytes)
+	})
+
+	t.Run("ZCDNVTCLKDevEntry", func(t *testing.T) {
+		s := ZCDNVTCLKDevEntry{
+			TXFrameCounter: 0x01020304,
+			RXFrameCounter: 0x05060708,
+			Address:        zigbee.IEEEAddress(0x0102030405060708),
+			KeyAttributes:  0x02,
+			KeyType:        0x00,
+			SeedShift:      0x03,
+		}
+
+		actualBytes, err := bytecodec.Marshal(s)
+
+		expectedBytes := []byte{0x04, 0x03, 0x02, 0x01, 0x08, 0x07, 0x06, 0x05, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x02, 0x00, 0x03}
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedBytes, actualBytes)
+	})
+
+	t.Run("ZCDNVNwkSecMaterial", func(t *testing.T) {
+		s := ZCDNVNwkSecMaterial{
+			FrameCounter:  0x01020304,
+			ExtendedPANID: zigbee.ExtendedPANID(0x0102030405060708),
+		}
+
+		actualBytes, err := bytecodec.Marshal(s)
+
+		expectedBytes := []byte{0x04, 0x03, 0x02, 0x01, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01}
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedBytes, actualBytes)
+	})
+}
+
+func Test_deleteNVRAMByID(t *testing.T) {
+	t.Run("does not delete an item which does not exist", func(t *testing.T) {
+		mrr := new(MockRequestResponder)
+		defer mrr.AssertExpectations(t)
+
+		z := ZStack{requestResponder: mrr}
+
+		mrr.On("RequestResponse", mock.Anything, SysOSALNVLength{NVItemID: ZCDNVNIBID}, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			reply := args.Get(2).(*SysOSALNVLengthReply)
+			reply.Length = 0
+		})
+
+		err := z.deleteNVRAMByID(context.Background(), ZCDNVNIBID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("returns an error if the delete was unsuccessful", func(t *testing.T) {
+		mrr := new(MockRequestResponder)
+		defer mrr.AssertExpectations(t)
+
+		z := ZStack{requestResponder: mrr}
+
+		mrr.On("RequestResponse", mock.Anything, SysOSALNVLength{NVItemID: ZCDNVNIBID}, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			reply := args.Get(2).(*SysOSALNVLengthReply)
+			reply.Length = 0x74
+		})
+
+		mrr.On("RequestResponse", mock.Anything, SysOSALNVDelete{NVItemID: ZCDNVNIBID, Length: 0x74}, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			reply := args.Get(2).(*SysOSALNVDeleteReply)
+			reply.Status = ZFailure
+		})
+
+		err := z.deleteNVRAMByID(context.Background(), ZCDNVNIBID)
+		assert.ErrorIs(t, err, NVRAMUnsuccessful)
+	})
+}
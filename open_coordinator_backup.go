@@ -0,0 +1,382 @@
+package zstack
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/shimmeringbee/zigbee"
+	"slices"
+	"strconv"
+)
+
+const (
+	OpenCoordinatorBackupFormat  = "zigpy/open-coordinator-backup"
+	OpenCoordinatorBackupVersion = 1
+	OpenCoordinatorBackupSource  = "shimmeringbee/zstack"
+)
+
+const openCoordinatorBackupSecurityLevel uint8 = 5
+
+var globalTCLinkKeyAddress = zigbee.IEEEAddress(0xffffffffffffffff)
+
+type OpenCoordinatorBackup struct {
+	Metadata        OpenCoordinatorBackupMetadata      `json:"metadata"`
+	StackSpecific   OpenCoordinatorBackupStackSpecific `json:"stack_specific"`
+	CoordinatorIEEE string                             `json:"coordinator_ieee"`
+	PANID           string                             `json:"pan_id"`
+	ExtendedPANID   string                             `json:"extended_pan_id"`
+	NWKUpdateID     uint8                              `json:"nwk_update_id"`
+	SecurityLevel   uint8                              `json:"security_level"`
+	Channel         uint8                              `json:"channel"`
+	ChannelMask     []uint8                            `json:"channel_mask"`
+	NetworkKey      OpenCoordinatorBackupNetworkKey    `json:"network_key"`
+	Devices         []OpenCoordinatorBackupDevice      `json:"devices"`
+}
+
+type OpenCoordinatorBackupMetadata struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Source  string `json:"source"`
+}
+
+type OpenCoordinatorBackupStackSpecific struct {
+	ZStack *OpenCoordinatorBackupZStack `json:"zstack,omitempty"`
+}
+
+type OpenCoordinatorBackupZStack struct {
+	TCLinkKeySeed string `json:"tclk_seed,omitempty"`
+}
+
+type OpenCoordinatorBackupNetworkKey struct {
+	Key            string `json:"key"`
+	SequenceNumber uint8  `json:"sequence_number"`
+	FrameCounter   uint32 `json:"frame_counter"`
+}
+
+type OpenCoordinatorBackupDevice struct {
+	NetworkAddress *string                       `json:"nwk_address"`
+	IEEEAddress    string                        `json:"ieee_address"`
+	IsChild        bool                          `json:"is_child"`
+	LinkKey        *OpenCoordinatorBackupLinkKey `json:"link_key,omitempty"`
+}
+
+type OpenCoordinatorBackupLinkKey struct {
+	Key       string `json:"key"`
+	RXCounter uint32 `json:"rx_counter"`
+	TXCounter uint32 `json:"tx_counter"`
+}
+
+func ParseOpenCoordinatorBackup(data []byte) (OpenCoordinatorBackup, error) {
+	o := OpenCoordinatorBackup{}
+
+	if err := json.Unmarshal(data, &o); err != nil {
+		return OpenCoordinatorBackup{}, err
+	}
+
+	if o.Metadata.Format != OpenCoordinatorBackupFormat {
+		return OpenCoordinatorBackup{}, fmt.Errorf("unsupported backup format: %s", o.Metadata.Format)
+	}
+
+	if o.Metadata.Version != OpenCoordinatorBackupVersion {
+		return OpenCoordinatorBackup{}, fmt.Errorf("unsupported backup version: %d", o.Metadata.Version)
+	}
+
+	return o, nil
+}
+
+func NewOpenCoordinatorBackup(b Backup, nodes []zigbee.Node) OpenCoordinatorBackup {
+	o := OpenCoordinatorBackup{
+		Metadata: OpenCoordinatorBackupMetadata{
+			Format:  OpenCoordinatorBackupFormat,
+			Version: OpenCoordinatorBackupVersion,
+			Source:  OpenCoordinatorBackupSource,
+		},
+		CoordinatorIEEE: b.IEEEAddress.String(),
+		PANID:           fmt.Sprintf("%04x", uint16(b.PANID)),
+		ExtendedPANID:   fmt.Sprintf("%016x", uint64(b.ExtendedPANID)),
+		SecurityLevel:   openCoordinatorBackupSecurityLevel,
+		Channel:         b.Channel,
+		ChannelMask:     []uint8{b.Channel},
+		NetworkKey: OpenCoordinatorBackupNetworkKey{
+			Key:            hex.EncodeToString(b.NetworkKey[:]),
+			SequenceNumber: b.NetworkKeySequence,
+			FrameCounter:   b.NetworkFrameCounter,
+		},
+		Devices: []OpenCoordinatorBackupDevice{},
+	}
+
+	if b.Version.IsV3() {
+		o.StackSpecific.ZStack = &OpenCoordinatorBackupZStack{TCLinkKeySeed: hex.EncodeToString(b.TCLinkKeySeed[:])}
+	}
+
+	tcLinkKeys := slices.Concat(b.TCLinkKeys, deriveTCLinkKeys(b.TCLinkKeySeed, b.TCLinkKeyTable))
+	linkKeys := map[zigbee.IEEEAddress]ZCDNVTCLKTableStart{}
+
+	for _, entry := range tcLinkKeys {
+		if entry.Address != globalTCLinkKeyAddress {
+			linkKeys[entry.Address] = entry
+		}
+	}
+
+	for _, node := range nodes {
+		if node.IEEEAddress == b.IEEEAddress {
+			continue
+		}
+
+		networkAddress := fmt.Sprintf("%04x", uint16(node.NetworkAddress))
+
+		device := OpenCoordinatorBackupDevice{
+			NetworkAddress: &networkAddress,
+			IEEEAddress:    node.IEEEAddress.String(),
+			IsChild:        node.LogicalType == zigbee.EndDevice && node.Depth == 1,
+		}
+
+		if entry, found := linkKeys[node.IEEEAddress]; found {
+			device.LinkKey = newOpenCoordinatorBackupLinkKey(entry)
+			delete(linkKeys, node.IEEEAddress)
+		}
+
+		o.Devices = append(o.Devices, device)
+	}
+
+	for _, entry := range tcLinkKeys {
+		if linkKey, found := linkKeys[entry.Address]; found {
+			o.Devices = append(o.Devices, OpenCoordinatorBackupDevice{
+				IEEEAddress: entry.Address.String(),
+				LinkKey:     newOpenCoordinatorBackupLinkKey(linkKey),
+			})
+			delete(linkKeys, entry.Address)
+		}
+	}
+
+	return o
+}
+
+func newOpenCoordinatorBackupLinkKey(entry ZCDNVTCLKTableStart) *OpenCoordinatorBackupLinkKey {
+	return &OpenCoordinatorBackupLinkKey{
+		Key:       hex.EncodeToString(entry.NetworkKey[:]),
+		RXCounter: entry.RXFrameCounter,
+		TXCounter: entry.TXFrameCounter,
+	}
+}
+
+func (o OpenCoordinatorBackup) Backup() (Backup, error) {
+	b := Backup{
+		Channel:             o.Channel,
+		NetworkKeySequence:  o.NetworkKey.SequenceNumber,
+		NetworkFrameCounter: o.NetworkKey.FrameCounter,
+		TCLinkKeys: []ZCDNVTCLKTableStart{
+			{Address: globalTCLinkKeyAddress, NetworkKey: zigbee.TCLinkKey},
+		},
+	}
+
+	if ieee, err := parseHexUint(o.CoordinatorIEEE, 64); err != nil {
+		return Backup{}, fmt.Errorf("invalid coordinator ieee: %w", err)
+	} else {
+		b.IEEEAddress = zigbee.IEEEAddress(ieee)
+	}
+
+	if panID, err := parseHexUint(o.PANID, 16); err != nil {
+		return Backup{}, fmt.Errorf("invalid pan id: %w", err)
+	} else {
+		b.PANID = zigbee.PANID(panID)
+	}
+
+	if extPANID, err := parseHexUint(o.ExtendedPANID, 64); err != nil {
+		return Backup{}, fmt.Errorf("invalid extended pan id: %w", err)
+	} else {
+		b.ExtendedPANID = zigbee.ExtendedPANID(extPANID)
+	}
+
+	if err := parseHexKey(o.NetworkKey.Key, &b.NetworkKey); err != nil {
+		return Backup{}, fmt.Errorf("invalid network key: %w", err)
+	}
+
+	if o.StackSpecific.ZStack != nil && len(o.StackSpecific.ZStack.TCLinkKeySeed) > 0 {
+		if err := parseHexKey(o.StackSpecific.ZStack.TCLinkKeySeed, &b.TCLinkKeySeed); err != nil {
+			return Backup{}, fmt.Errorf("invalid tclk seed: %w", err)
+		}
+	}
+
+	for _, device := range o.Devices {
+		if device.LinkKey == nil {
+			continue
+		}
+
+		entry := ZCDNVTCLKTableStart{
+			TXFrameCounter: device.LinkKey.TXCounter,
+			RXFrameCounter: device.LinkKey.RXCounter,
+		}
+
+		if ieee, err := parseHexUint(device.IEEEAddress, 64); err != nil {
+			return Backup{}, fmt.Errorf("invalid device ieee: %w", err)
+		} else {
+			entry.Address = zigbee.IEEEAddress(ieee)
+		}
+
+		if err := parseHexKey(device.LinkKey.Key, &entry.NetworkKey); err != nil {
+			return Backup{}, fmt.Errorf("invalid device link key: %w", err)
+		}
+
+		b.TCLinkKeys = append(b.TCLinkKeys, entry)
+	}
+
+	b.TCLinkKeySeed, b.TCLinkKeyTable = seededTCLinkKeyTable(b.TCLinkKeySeed, b.TCLinkKeys)
+
+	return b, nil
+}
+
+/*
+Z-Stack 3.X.X does not store unique link keys, they are derived from the TCLK seed rotated by the entries shift and XORed
+with the devices IEEE address.
+*/
+func deriveTCLinkKey(seed zigbee.NetworkKey, address zigbee.IEEEAddress, shift uint8) zigbee.NetworkKey {
+	ieee := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ieee, uint64(address))
+
+	var key zigbee.NetworkKey
+
+	for i := range key {
+		key[i] = seed[(i+int(shift))%len(seed)] ^ ieee[i%len(ieee)]
+	}
+
+	return key
+}
+
+func findTCLinkKeySeedShift(seed zigbee.NetworkKey, address zigbee.IEEEAddress, key zigbee.NetworkKey) (uint8, bool) {
+	for shift := uint8(0); shift < uint8(len(seed)); shift++ {
+		if deriveTCLinkKey(seed, address, shift) == key {
+			return shift, true
+		}
+	}
+
+	return 0, false
+}
+
+func deriveTCLinkKeys(seed zigbee.NetworkKey, table []ZCDNVTCLKDevEntry) []ZCDNVTCLKTableStart {
+	var entries []ZCDNVTCLKTableStart
+
+	for _, entry := range table {
+		entries = append(entries, ZCDNVTCLKTableStart{
+			Address:        entry.Address,
+			NetworkKey:     deriveTCLinkKey(seed, entry.Address, entry.SeedShift),
+			TXFrameCounter: entry.TXFrameCounter,
+			RXFrameCounter: entry.RXFrameCounter,
+		})
+	}
+
+	return entries
+}
+
+/*
+Maps device link keys onto a Z-Stack 3.X.X TCLK table. Backups from other stacks often lack a seed, in which case one is
+chosen so that the first device key is derived with no shift. Keys which can not be derived from the seed are omitted.
+*/
+func seededTCLinkKeyTable(seed zigbee.NetworkKey, keys []ZCDNVTCLKTableStart) (zigbee.NetworkKey, []ZCDNVTCLKDevEntry) {
+	var table []ZCDNVTCLKDevEntry
+
+	for _, entry := range keys {
+		if entry.Address == globalTCLinkKeyAddress {
+			continue
+		}
+
+		if seed == (zigbee.NetworkKey{}) {
+			seed = deriveTCLinkKey(entry.NetworkKey, entry.Address, 0)
+		}
+
+		if shift, found := findTCLinkKeySeedShift(seed, entry.Address, entry.NetworkKey); found {
+			table = append(table, ZCDNVTCLKDevEntry{
+				TXFrameCounter: entry.TXFrameCounter,
+				RXFrameCounter: entry.RXFrameCounter,
+				Address:        entry.Address,
+				KeyAttributes:  TCLKKeyAttributesVerified,
+				SeedShift:      shift,
+			})
+		}
+	}
+
+	return seed, table
+}
+
+func (o OpenCoordinatorBackup) Nodes() ([]zigbee.Node, error) {
+	var nodes []zigbee.Node
+
+	for _, device := range o.Devices {
+		if device.NetworkAddress == nil {
+			continue
+		}
+
+		node := zigbee.Node{LogicalType: zigbee.Unknown}
+
+		if ieee, err := parseHexUint(device.IEEEAddress, 64); err != nil {
+			return nil, fmt.Errorf("invalid device ieee: %w", err)
+		} else {
+			node.IEEEAddress = zigbee.IEEEAddress(ieee)
+		}
+
+		if network, err := parseHexUint(*device.NetworkAddress, 16); err != nil {
+			return nil, fmt.Errorf("invalid device network address: %w", err)
+		} else {
+			node.NetworkAddress = zigbee.NetworkAddress(network)
+		}
+
+		if device.IsChild {
+			node.LogicalType = zigbee.EndDevice
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+func (z *ZStack) ExportOpenCoordinatorBackup(ctx context.Context) (OpenCoordinatorBackup, error) {
+	b, err := z.Backup(ctx)
+	if err != nil {
+		return OpenCoordinatorBackup{}, err
+	}
+
+	return NewOpenCoordinatorBackup(b, z.nodeTable.nodes()), nil
+}
+
+func (z *ZStack) ImportOpenCoordinatorBackup(ctx context.Context, o OpenCoordinatorBackup) error {
+	b, err := o.Backup()
+	if err != nil {
+		return err
+	}
+
+	nodes, err := o.Nodes()
+	if err != nil {
+		return err
+	}
+
+	if err := z.Restore(ctx, b); err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		z.nodeTable.addOrUpdate(node.IEEEAddress, node.NetworkAddress, logicalType(node.LogicalType))
+	}
+
+	return nil
+}
+
+func parseHexUint(s string, bitSize int) (uint64, error) {
+	return strconv.ParseUint(s, 16, bitSize)
+}
+
+func parseHexKey(s string, key *zigbee.NetworkKey) error {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	if len(data) != len(key) {
+		return fmt.Errorf("key must be %d bytes, got %d", len(key), len(data))
+	}
+
+	copy(key[:], data)
+	return nil
+}
@@ -0,0 +1,236 @@
+package zstack
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const exampleOpenCoordinatorBackup = `{
+  "metadata": {
+    "format": "zigpy/open-coordinator-backup",
+    "version": 1,
+    "source": "zigbee-herdsman@0.13.65"
+  },
+  "stack_specific": {
+    "zstack": {
+      "tclk_seed": "0102030405060708090a0b0c0d0e0f10"
+    }
+  },
+  "coordinator_ieee": "00124b0014d9cd6f",
+  "pan_id": "8fa5",
+  "extended_pan_id": "dddddddddddddddd",
+  "nwk_update_id": 0,
+  "security_level": 5,
+  "channel": 11,
+  "channel_mask": [11],
+  "network_key": {
+    "key": "01030507090b0d0f00020406080a0c0d",
+    "sequence_number": 2,
+    "frame_counter": 16000
+  },
+  "devices": [
+    {
+      "nwk_address": "3c2b",
+      "ieee_address": "00158d0001d82999",
+      "is_child": true
+    },
+    {
+      "nwk_address": null,
+      "ieee_address": "00158d0001d82998",
+      "is_child": false,
+      "link_key": {
+        "key": "5a6967426565416c6c69616e63653039",
+        "rx_counter": 1,
+        "tx_counter": 2
+      }
+    }
+  ]
+}`
+
+func Test_ParseOpenCoordinatorBackup(t *testing.T) {
+	t.Run("parses a backup into a backup and nodes", func(t *testing.T) {
+		o, err := ParseOpenCoordinatorBackup([]byte(exampleOpenCoordinatorBackup))
+		assert.NoError(t, err)
+
+		b, err := o.Backup()
+		assert.NoError(t, err)
+
+		assert.Equal(t, zigbee.IEEEAddress(0x00124b0014d9cd6f), b.IEEEAddress)
+		assert.Equal(t, zigbee.PANID(0x8fa5), b.PANID)
+		assert.Equal(t, zigbee.ExtendedPANID(0xdddddddddddddddd), b.ExtendedPANID)
+		assert.Equal(t, uint8(11), b.Channel)
+		assert.Equal(t, zigbee.NetworkKey{0x01, 0x03, 0x05, 0x07, 0x09, 0x0b, 0x0d, 0x0f, 0x00, 0x02, 0x04, 0x06, 0x08, 0x0a, 0x0c, 0x0d}, b.NetworkKey)
+		assert.Equal(t, uint8(2), b.NetworkKeySequence)
+		assert.Equal(t, uint32(16000), b.NetworkFrameCounter)
+		assert.Equal(t, zigbee.NetworkKey{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}, b.TCLinkKeySeed)
+		assert.Equal(t, []ZCDNVTCLKTableStart{
+			{Address: globalTCLinkKeyAddress, NetworkKey: zigbee.TCLinkKey},
+			{Address: zigbee.IEEEAddress(0x00158d0001d82998), NetworkKey: zigbee.TCLinkKey, RXFrameCounter: 1, TXFrameCounter: 2},
+		}, b.TCLinkKeys)
+
+		nodes, err := o.Nodes()
+		assert.NoError(t, err)
+		assert.Equal(t, []zigbee.Node{
+			{IEEEAddress: zigbee.IEEEAddress(0x00158d0001d82999), NetworkAddress: zigbee.NetworkAddress(0x3c2b), LogicalType: zigbee.EndDevice},
+		}, nodes)
+	})
+
+	t.Run("rejects backups of an unknown format", func(t *testing.T) {
+		_, err := ParseOpenCoordinatorBackup([]byte(`{"metadata": {"format": "other", "version": 1}}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects backups of an unknown version", func(t *testing.T) {
+		_, err := ParseOpenCoordinatorBackup([]byte(`{"metadata": {"format": "zigpy/open-coordinator-backup", "version": 2}}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects backups with malformed keys", func(t *testing.T) {
+		o, err := ParseOpenCoordinatorBackup([]byte(exampleOpenCoordinatorBackup))
+		assert.NoError(t, err)
+
+		o.NetworkKey.Key = "0102"
+
+		_, err = o.Backup()
+		assert.Error(t, err)
+	})
+}
+
+func Test_NewOpenCoordinatorBackup(t *testing.T) {
+	t.Run("a backup survives a round trip through json", func(t *testing.T) {
+		expected := Backup{
+			IEEEAddress:         zigbee.IEEEAddress(0x00124b0014d9cd6f),
+			PANID:               zigbee.PANID(0x0102),
+			ExtendedPANID:       zigbee.ExtendedPANID(0x0102030405060708),
+			Channel:             15,
+			NetworkKey:          zigbee.NetworkKey{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			NetworkKeySequence:  1,
+			NetworkFrameCounter: 5000,
+			TCLinkKeys: []ZCDNVTCLKTableStart{
+				{Address: globalTCLinkKeyAddress, NetworkKey: zigbee.TCLinkKey},
+				{Address: zigbee.IEEEAddress(0x1122334455667788), NetworkKey: zigbee.TCLinkKey, TXFrameCounter: 3, RXFrameCounter: 4},
+			},
+		}
+
+		nodes := []zigbee.Node{
+			{IEEEAddress: expected.IEEEAddress, NetworkAddress: 0x0000, LogicalType: zigbee.Coordinator},
+			{IEEEAddress: zigbee.IEEEAddress(0x1122334455667788), NetworkAddress: 0x1234, LogicalType: zigbee.EndDevice, Depth: 1},
+		}
+
+		data, err := json.Marshal(NewOpenCoordinatorBackup(expected, nodes))
+		assert.NoError(t, err)
+
+		o, err := ParseOpenCoordinatorBackup(data)
+		assert.NoError(t, err)
+
+		assert.Len(t, o.Devices, 1)
+		assert.NotNil(t, o.Devices[0].LinkKey)
+		assert.Nil(t, o.StackSpecific.ZStack)
+
+		actual, err := o.Backup()
+		assert.NoError(t, err)
+
+		seed := deriveTCLinkKey(zigbee.TCLinkKey, zigbee.IEEEAddress(0x1122334455667788), 0)
+		expected.TCLinkKeySeed = seed
+		expected.TCLinkKeyTable = []ZCDNVTCLKDevEntry{
+			{Address: zigbee.IEEEAddress(0x1122334455667788), KeyAttributes: TCLKKeyAttributesVerified, TXFrameCounter: 3, RXFrameCounter: 4},
+		}
+
+		assert.Equal(t, expected, actual)
+
+		actualNodes, err := o.Nodes()
+		assert.NoError(t, err)
+		assert.Equal(t, []zigbee.Node{
+			{IEEEAddress: zigbee.IEEEAddress(0x1122334455667788), NetworkAddress: 0x1234, LogicalType: zigbee.EndDevice},
+		}, actualNodes)
+	})
+}
+
+func Test_NewOpenCoordinatorBackup_V3(t *testing.T) {
+	seed := zigbee.NetworkKey{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+	device := zigbee.IEEEAddress(0x1122334455667788)
+
+	t.Run("a z-stack 3.X.X backup exports link keys derived from the seed and survives a round trip through json", func(t *testing.T) {
+		expected := Backup{
+			Version:             Version{ProductID: 2},
+			IEEEAddress:         zigbee.IEEEAddress(0x00124b0014d9cd6f),
+			PANID:               zigbee.PANID(0x0102),
+			ExtendedPANID:       zigbee.ExtendedPANID(0x0102030405060708),
+			Channel:             15,
+			NetworkKey:          zigbee.NetworkKey{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			NetworkKeySequence:  1,
+			NetworkFrameCounter: 5000,
+			TCLinkKeySeed:       seed,
+			TCLinkKeyTable: []ZCDNVTCLKDevEntry{
+				{Address: device, KeyAttributes: TCLKKeyAttributesVerified, SeedShift: 3, TXFrameCounter: 3, RXFrameCounter: 4},
+			},
+		}
+
+		nodes := []zigbee.Node{
+			{IEEEAddress: device, NetworkAddress: 0x1234, LogicalType: zigbee.EndDevice, Depth: 1},
+		}
+
+		data, err := json.Marshal(NewOpenCoordinatorBackup(expected, nodes))
+		assert.NoError(t, err)
+
+		o, err := ParseOpenCoordinatorBackup(data)
+		assert.NoError(t, err)
+
+		linkKey := deriveTCLinkKey(seed, device, 3)
+
+		assert.Len(t, o.Devices, 1)
+		assert.Equal(t, &OpenCoordinatorBackupLinkKey{
+			Key:       hex.EncodeToString(linkKey[:]),
+			RXCounter: 4,
+			TXCounter: 3,
+		}, o.Devices[0].LinkKey)
+
+		actual, err := o.Backup()
+		assert.NoError(t, err)
+
+		assert.Equal(t, expected.TCLinkKeySeed, actual.TCLinkKeySeed)
+		assert.Equal(t, expected.TCLinkKeyTable, actual.TCLinkKeyTable)
+	})
+
+	t.Run("a backup without a tclk seed imports device link keys against a seed derived from the first key", func(t *testing.T) {
+		o, err := ParseOpenCoordinatorBackup([]byte(exampleOpenCoordinatorBackup))
+		assert.NoError(t, err)
+
+		o.StackSpecific.ZStack = nil
+
+		b, err := o.Backup()
+		assert.NoError(t, err)
+
+		assert.NotEqual(t, zigbee.NetworkKey{}, b.TCLinkKeySeed)
+		assert.Len(t, b.TCLinkKeyTable, 1)
+
+		entry := b.TCLinkKeyTable[0]
+		assert.Equal(t, zigbee.IEEEAddress(0x00158d0001d82998), entry.Address)
+		assert.Equal(t, zigbee.TCLinkKey, deriveTCLinkKey(b.TCLinkKeySeed, entry.Address, entry.SeedShift))
+	})
+}
+
+func Test_deriveTCLinkKey(t *testing.T) {
+	t.Run("rotates the seed by the shift and XORs it with the ieee address", func(t *testing.T) {
+		seed := zigbee.NetworkKey{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f}
+
+		actual := deriveTCLinkKey(seed, zigbee.IEEEAddress(0x0000000000000001), 2)
+
+		assert.Equal(t, zigbee.NetworkKey{0x03, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0b, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x00, 0x01}, actual)
+	})
+
+	t.Run("finds the shift which derives a key", func(t *testing.T) {
+		seed := zigbee.NetworkKey{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f}
+		address := zigbee.IEEEAddress(0x1122334455667788)
+
+		shift, found := findTCLinkKeySeedShift(seed, address, deriveTCLinkKey(seed, address, 7))
+		assert.True(t, found)
+		assert.Equal(t, uint8(7), shift)
+
+		_, found = findTCLinkKeySeedShift(seed, address, zigbee.TCLinkKey)
+		assert.False(t, found)
+	})
+}
@@ -0,0 +1,135 @@
+package zstack
+
+import (
+	"github.com/shimmeringbee/zigbee"
+	"time"
+)
+
+type Option func(*options)
+
+type options struct {
+	timeout                 time.Duration
+	retries                 int
+	inflightEvents          int
+	eventOverflowPolicy     OverflowPolicy
+	inflightTransactions    int
+	radius                  uint8
+	pollingInterval         time.Duration
+	resolveIEEETimeout      time.Duration
+	schedulerCapacity       int64
+	transactionQuarantine   time.Duration
+	sleepyMessageTTL        time.Duration
+	nodeConcurrency         int
+	circuitBreakerThreshold int
+	circuitBreakerCooldown  time.Duration
+	deliveryPolicy          *DeliveryPolicy
+	recoveryAttempts        int
+	recoveryBackoff         time.Duration
+	apsFragmentation        bool
+	automaticChannel        bool
+	permittedChannels       []uint8
+}
+
+func defaultOptions() options {
+	return options{
+		timeout:                 DefaultZStackTimeout,
+		retries:                 DefaultZStackRetries,
+		inflightEvents:          DefaultInflightEvents,
+		eventOverflowPolicy:     OverflowBlock,
+		inflightTransactions:    DefaultInflightTransactions,
+		radius:                  DefaultRadius,
+		pollingInterval:         defaultPollingInterval * time.Second,
+		resolveIEEETimeout:      DefaultResolveIEEETimeout,
+		transactionQuarantine:   DefaultTransactionQuarantine,
+		nodeConcurrency:         DefaultNodeConcurrency,
+		circuitBreakerThreshold: DefaultCircuitBreakerThreshold,
+		circuitBreakerCooldown:  DefaultCircuitBreakerCooldown,
+		recoveryAttempts:        DefaultAdapterRecoveryAttempts,
+		recoveryBackoff:         DefaultAdapterRecoveryBackoff,
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+func WithRetries(retries int) Option {
+	return func(o *options) {
+		o.retries = retries
+	}
+}
+
+func WithInflightEvents(events int) Option {
+	return func(o *options) {
+		o.inflightEvents = events
+	}
+}
+
+/*
+ReadEvent is lossless by default, holding up the adapter until events are read. Consumers which would rather lose events
+than stall may choose a dropping policy, with losses reported by DroppedEvents.
+*/
+func WithEventOverflowPolicy(policy OverflowPolicy) Option {
+	return func(o *options) {
+		o.eventOverflowPolicy = policy
+	}
+}
+
+/* Transaction IDs are a single byte, so no more than 256 transactions may be in flight. */
+func WithInflightTransactions(transactions int) Option {
+	return func(o *options) {
+		o.inflightTransactions = min(transactions, transactionIDSpace)
+	}
+}
+
+func WithTransactionQuarantine(quarantine time.Duration) Option {
+	return func(o *options) {
+		o.transactionQuarantine = quarantine
+	}
+}
+
+func WithRadius(radius uint8) Option {
+	return func(o *options) {
+		o.radius = radius
+	}
+}
+
+func WithPollingInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.pollingInterval = interval
+	}
+}
+
+func WithResolveIEEETimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.resolveIEEETimeout = timeout
+	}
+}
+
+/* Overrides the number of concurrent adapter requests, by default chosen from the adapter version during Initialise. */
+func WithSchedulerCapacity(capacity int64) Option {
+	return func(o *options) {
+		o.schedulerCapacity = capacity
+	}
+}
+
+/* Permits acknowledged unicast payloads too large for an AfDataRequest, which are staged and sent using APS fragmentation. */
+func WithAPSFragmentation() Option {
+	return func(o *options) {
+		o.apsFragmentation = true
+	}
+}
+
+/* Moves a newly formed network to the quietest of the permitted channels, or of all channels if none are given. */
+func WithAutomaticChannelSelection(permittedChannels ...uint8) Option {
+	return func(o *options) {
+		if len(permittedChannels) == 0 {
+			permittedChannels = zigbee.Channels
+		}
+
+		o.automaticChannel = true
+		o.permittedChannels = permittedChannels
+	}
+}
@@ -0,0 +1,105 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_Options(t *testing.T) {
+	t.Run("defaults are used when no options are provided", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		assert.Equal(t, DefaultZStackTimeout, zstack.config.timeout)
+		assert.Equal(t, DefaultZStackRetries, zstack.config.retries)
+		assert.Equal(t, DefaultRadius, zstack.config.radius)
+		assert.Equal(t, defaultPollingInterval*time.Second, zstack.config.pollingInterval)
+		assert.Equal(t, DefaultResolveIEEETimeout, zstack.config.resolveIEEETimeout)
+		assert.Equal(t, DefaultInflightTransactions, zstack.transactionPool.maxOutstanding)
+		assert.Equal(t, DefaultInflightEvents, cap(zstack.networkManagerIncoming))
+		assert.Equal(t, OverflowBlock, zstack.events.policy)
+	})
+
+	t.Run("event overflow policy can be chosen", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New(), WithInflightEvents(1), WithEventOverflowPolicy(OverflowDropOldest))
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		zstack.sendEvent("first")
+		zstack.sendEvent("second")
+
+		event, err := zstack.ReadEvent(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "second", event)
+		assert.Equal(t, uint64(1), zstack.DroppedEvents())
+	})
+
+	t.Run("options override defaults", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New(),
+			WithTimeout(10*time.Second),
+			WithRetries(5),
+			WithInflightEvents(100),
+			WithInflightTransactions(40),
+			WithRadius(0x10),
+			WithPollingInterval(2*time.Minute),
+			WithResolveIEEETimeout(time.Second),
+			WithSchedulerCapacity(4),
+		)
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		assert.Equal(t, 10*time.Second, zstack.config.timeout)
+		assert.Equal(t, 5, zstack.config.retries)
+		assert.Equal(t, uint8(0x10), zstack.config.radius)
+		assert.Equal(t, 2*time.Minute, zstack.config.pollingInterval)
+		assert.Equal(t, time.Second, zstack.config.resolveIEEETimeout)
+		assert.Equal(t, 40, zstack.transactionPool.maxOutstanding)
+		assert.Equal(t, 100, cap(zstack.networkManagerIncoming))
+	})
+
+	t.Run("inflight transactions are limited to the size of a transaction id", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New(), WithInflightTransactions(1000))
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		assert.Equal(t, 256, zstack.transactionPool.maxOutstanding)
+	})
+
+	t.Run("scheduler capacity overrides the version derived capacity", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New(), WithSchedulerCapacity(1))
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		zstack.initialiseScheduler(Version{ProductID: 1})
+
+		assert.Equal(t, int64(1), zstack.SchedulerStats().Capacity)
+	})
+
+	t.Run("aps fragmentation is disabled unless enabled", func(t *testing.T) {
+		assert.False(t, defaultOptions().apsFragmentation)
+
+		o := defaultOptions()
+		WithAPSFragmentation()(&o)
+		assert.True(t, o.apsFragmentation)
+	})
+	t.Run("automatic channel selection defaults to all channels if none are provided", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New(), WithAutomaticChannelSelection())
+		defer unpiMock.Stop()
+		defer zstack.Stop(context.Background())
+
+		assert.True(t, zstack.config.automaticChannel)
+		assert.Equal(t, zigbee.Channels, zstack.config.permittedChannels)
+	})
+}
@@ -0,0 +1,222 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/zigbee"
+	"sync"
+	"time"
+)
+
+type Priority uint8
+
+const (
+	PriorityInteractive Priority = iota
+	PriorityInterview
+	PriorityBackground
+
+	priorityCount
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityInteractive:
+		return "Interactive"
+	case PriorityInterview:
+		return "Interview"
+	case PriorityBackground:
+		return "Background"
+	default:
+		return "Unknown"
+	}
+}
+
+type SchedulerClassStats struct {
+	QueueDepth  int
+	Dispatched  uint64
+	AverageWait time.Duration
+	MaxWait     time.Duration
+}
+
+type SchedulerStats struct {
+	Capacity int64
+	InUse    int64
+	Classes  map[Priority]SchedulerClassStats
+}
+
+type schedulerWaiter struct {
+	destination zigbee.NetworkAddress
+	ready       chan struct{}
+	granted     bool
+	enqueued    time.Time
+}
+
+/* Each class holds a queue per destination, which are served round-robin so one busy node can not starve the others. */
+type schedulerClass struct {
+	queues map[zigbee.NetworkAddress][]*schedulerWaiter
+	ring   []zigbee.NetworkAddress
+
+	dispatched uint64
+	totalWait  time.Duration
+	maxWait    time.Duration
+}
+
+type scheduler struct {
+	lock     sync.Mutex
+	capacity int64
+	inUse    int64
+	classes  [priorityCount]*schedulerClass
+}
+
+func newScheduler(capacity int64) *scheduler {
+	s := &scheduler{capacity: capacity}
+
+	for i := range s.classes {
+		s.classes[i] = &schedulerClass{queues: map[zigbee.NetworkAddress][]*schedulerWaiter{}}
+	}
+
+	return s
+}
+
+func (s *scheduler) setCapacity(capacity int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.capacity = capacity
+	s.dispatch()
+}
+
+func (s *scheduler) acquire(ctx context.Context, priority Priority, destination zigbee.NetworkAddress) (func(), error) {
+	w := &schedulerWaiter{destination: destination, ready: make(chan struct{}), enqueued: time.Now()}
+	class := s.classes[priority]
+
+	s.lock.Lock()
+	if _, found := class.queues[destination]; !found {
+		class.ring = append(class.ring, destination)
+	}
+	class.queues[destination] = append(class.queues[destination], w)
+	s.dispatch()
+	s.lock.Unlock()
+
+	release := sync.OnceFunc(s.release)
+
+	select {
+	case <-w.ready:
+		return release, nil
+	case <-ctx.Done():
+		s.lock.Lock()
+		granted := w.granted
+		if !granted {
+			class.remove(w)
+		}
+		s.lock.Unlock()
+
+		if granted {
+			release()
+		}
+
+		return nil, ctx.Err()
+	}
+}
+
+func (s *scheduler) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.inUse--
+	s.dispatch()
+}
+
+func (s *scheduler) dispatch() {
+	for s.inUse < s.capacity {
+		w, class := s.next()
+		if w == nil {
+			return
+		}
+
+		wait := time.Since(w.enqueued)
+		class.dispatched++
+		class.totalWait += wait
+		class.maxWait = max(class.maxWait, wait)
+
+		s.inUse++
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+func (s *scheduler) next() (*schedulerWaiter, *schedulerClass) {
+	for _, class := range s.classes {
+		if len(class.ring) == 0 {
+			continue
+		}
+
+		destination := class.ring[0]
+		class.ring = class.ring[1:]
+
+		queue := class.queues[destination]
+		w := queue[0]
+
+		if len(queue) > 1 {
+			class.queues[destination] = queue[1:]
+			class.ring = append(class.ring, destination)
+		} else {
+			delete(class.queues, destination)
+		}
+
+		return w, class
+	}
+
+	return nil, nil
+}
+
+func (c *schedulerClass) remove(w *schedulerWaiter) {
+	queue := c.queues[w.destination]
+
+	for i, queued := range queue {
+		if queued == w {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+
+	if len(queue) > 0 {
+		c.queues[w.destination] = queue
+		return
+	}
+
+	delete(c.queues, w.destination)
+
+	for i, destination := range c.ring {
+		if destination == w.destination {
+			c.ring = append(c.ring[:i], c.ring[i+1:]...)
+			break
+		}
+	}
+}
+
+func (s *scheduler) stats() SchedulerStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stats := SchedulerStats{Capacity: s.capacity, InUse: s.inUse, Classes: map[Priority]SchedulerClassStats{}}
+
+	for i, class := range s.classes {
+		classStats := SchedulerClassStats{Dispatched: class.dispatched, MaxWait: class.maxWait}
+
+		for _, queue := range class.queues {
+			classStats.QueueDepth += len(queue)
+		}
+
+		if class.dispatched > 0 {
+			classStats.AverageWait = class.totalWait / time.Duration(class.dispatched)
+		}
+
+		stats.Classes[Priority(i)] = classStats
+	}
+
+	return stats
+}
+
+func (z *ZStack) SchedulerStats() SchedulerStats {
+	return z.scheduler.stats()
+}
@@ -0,0 +1,100 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/zigbee"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_scheduler(t *testing.T) {
+	t.Run("grants requests up to capacity", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		s := newScheduler(1)
+
+		release, err := s.acquire(ctx, PriorityInteractive, 0x1000)
+		assert.NoError(t, err)
+
+		_, err = s.acquire(ctx, PriorityInteractive, 0x1000)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		release()
+
+		release, err = s.acquire(context.Background(), PriorityInteractive, 0x1000)
+		assert.NoError(t, err)
+		release()
+
+		stats := s.stats()
+		assert.Equal(t, int64(0), stats.InUse)
+		assert.Equal(t, 0, stats.Classes[PriorityInteractive].QueueDepth)
+		assert.Equal(t, uint64(2), stats.Classes[PriorityInteractive].Dispatched)
+	})
+
+	t.Run("higher priority requests are dispatched before lower priority", func(t *testing.T) {
+		s := newScheduler(1)
+
+		release, _ := s.acquire(context.Background(), PriorityInteractive, 0x0000)
+
+		order := make(chan Priority, 2)
+
+		for _, p := range []Priority{PriorityBackground, PriorityInteractive} {
+			go func(p Priority) {
+				r, _ := s.acquire(context.Background(), p, 0x1000)
+				order <- p
+				r()
+			}(p)
+
+			assert.Eventually(t, func() bool {
+				return s.stats().Classes[p].QueueDepth == 1
+			}, 100*time.Millisecond, time.Millisecond)
+		}
+
+		release()
+
+		assert.Equal(t, PriorityInteractive, <-order)
+		assert.Equal(t, PriorityBackground, <-order)
+	})
+
+	t.Run("destinations within a class are served round-robin", func(t *testing.T) {
+		s := newScheduler(1)
+
+		release, _ := s.acquire(context.Background(), PriorityInteractive, 0x0000)
+
+		order := make(chan zigbee.NetworkAddress, 3)
+
+		for _, destination := range []zigbee.NetworkAddress{0x1000, 0x1000, 0x2000} {
+			depth := s.stats().Classes[PriorityBackground].QueueDepth
+
+			go func(destination zigbee.NetworkAddress) {
+				r, _ := s.acquire(context.Background(), PriorityBackground, destination)
+				order <- destination
+				r()
+			}(destination)
+
+			assert.Eventually(t, func() bool {
+				return s.stats().Classes[PriorityBackground].QueueDepth == depth+1
+			}, 100*time.Millisecond, time.Millisecond)
+		}
+
+		release()
+
+		assert.Equal(t, zigbee.NetworkAddress(0x1000), <-order)
+		assert.Equal(t, zigbee.NetworkAddress(0x2000), <-order)
+		assert.Equal(t, zigbee.NetworkAddress(0x1000), <-order)
+	})
+
+	t.Run("cancelled requests are removed from the queue", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		s := newScheduler(0)
+
+		_, err := s.acquire(ctx, PriorityInterview, 0x1000)
+		assert.Error(t, err)
+		assert.Equal(t, 0, s.stats().Classes[PriorityInterview].QueueDepth)
+		assert.Empty(t, s.classes[PriorityInterview].ring)
+	})
+}
@@ -0,0 +1,228 @@
+package zstack
+
+import (
+	"fmt"
+	"reflect"
+)
+
+const (
+	ZSuccess                 ZStackStatus = 0x00
+	ZFailure                 ZStackStatus = 0x01
+	ZInvalidParameter        ZStackStatus = 0x02
+	ZInvalidTask             ZStackStatus = 0x03
+	ZMsgBufferNotAvail       ZStackStatus = 0x04
+	ZInvalidMsgPointer       ZStackStatus = 0x05
+	ZInvalidEventID          ZStackStatus = 0x06
+	ZInvalidInterruptID      ZStackStatus = 0x07
+	ZNoTimerAvail            ZStackStatus = 0x08
+	ZNVItemUninit            ZStackStatus = 0x09
+	ZNVOperFailed            ZStackStatus = 0x0a
+	ZInvalidMemSize          ZStackStatus = 0x0b
+	ZNVBadItemLen            ZStackStatus = 0x0c
+	ZMemError                ZStackStatus = 0x10
+	ZBufferFull              ZStackStatus = 0x11
+	ZUnsupportedMode         ZStackStatus = 0x12
+	ZMacMemError             ZStackStatus = 0x13
+	ZSapiInProgress          ZStackStatus = 0x20
+	ZSapiTimeout             ZStackStatus = 0x21
+	ZSapiInit                ZStackStatus = 0x22
+	ZNotAuthorized           ZStackStatus = 0x7e
+	ZdpInvalidRequestType    ZStackStatus = 0x80
+	ZdpDeviceNotFound        ZStackStatus = 0x81
+	ZdpInvalidEndpoint       ZStackStatus = 0x82
+	ZdpNotActive             ZStackStatus = 0x83
+	ZdpNotSupported          ZStackStatus = 0x84
+	ZdpTimeout               ZStackStatus = 0x85
+	ZdpNoMatch               ZStackStatus = 0x86
+	ZdpNoEntry               ZStackStatus = 0x88
+	ZdpNoDescriptor          ZStackStatus = 0x89
+	ZdpInsufficientSpace     ZStackStatus = 0x8a
+	ZdpNotPermitted          ZStackStatus = 0x8b
+	ZdpTableFull             ZStackStatus = 0x8c
+	ZdpNotAuthorized         ZStackStatus = 0x8d
+	ZdpBindingTableFull      ZStackStatus = 0x8e
+	ZApsFail                 ZStackStatus = 0xb1
+	ZApsTableFull            ZStackStatus = 0xb2
+	ZApsIllegalRequest       ZStackStatus = 0xb3
+	ZApsInvalidBinding       ZStackStatus = 0xb4
+	ZApsUnsupportedAttrib    ZStackStatus = 0xb5
+	ZApsNotSupported         ZStackStatus = 0xb6
+	ZApsNoAck                ZStackStatus = 0xb7
+	ZApsDuplicateEntry       ZStackStatus = 0xb8
+	ZApsNoBoundDevice        ZStackStatus = 0xb9
+	ZApsNotAllowed           ZStackStatus = 0xba
+	ZApsNotAuthenticated     ZStackStatus = 0xbb
+	ZSecNoKey                ZStackStatus = 0xa1
+	ZSecOldFrameCount        ZStackStatus = 0xa2
+	ZSecMaxFrameCount        ZStackStatus = 0xa3
+	ZSecCCMFail              ZStackStatus = 0xa4
+	ZSecFailure              ZStackStatus = 0xad
+	ZNwkInvalidParam         ZStackStatus = 0xc1
+	ZNwkInvalidRequest       ZStackStatus = 0xc2
+	ZNwkNotPermitted         ZStackStatus = 0xc3
+	ZNwkStartupFailure       ZStackStatus = 0xc4
+	ZNwkAlreadyPresent       ZStackStatus = 0xc5
+	ZNwkSyncFailure          ZStackStatus = 0xc6
+	ZNwkTableFull            ZStackStatus = 0xc7
+	ZNwkUnknownDevice        ZStackStatus = 0xc8
+	ZNwkUnsupportedAttrib    ZStackStatus = 0xc9
+	ZNwkNoNetworks           ZStackStatus = 0xca
+	ZNwkLeaveUnconfirmed     ZStackStatus = 0xcb
+	ZNwkNoAck                ZStackStatus = 0xcc
+	ZNwkNoRoute              ZStackStatus = 0xcd
+	ZMacBeaconLoss           ZStackStatus = 0xe0
+	ZMacChannelAccessFail    ZStackStatus = 0xe1
+	ZMacDenied               ZStackStatus = 0xe2
+	ZMacDisableTrxFailure    ZStackStatus = 0xe3
+	ZMacFailedSecurity       ZStackStatus = 0xe4
+	ZMacFrameTooLong         ZStackStatus = 0xe5
+	ZMacInvalidGTS           ZStackStatus = 0xe6
+	ZMacInvalidHandle        ZStackStatus = 0xe7
+	ZMacInvalidParameter     ZStackStatus = 0xe8
+	ZMacNoAck                ZStackStatus = 0xe9
+	ZMacNoBeacon             ZStackStatus = 0xea
+	ZMacNoData               ZStackStatus = 0xeb
+	ZMacNoShortAddress       ZStackStatus = 0xec
+	ZMacOutOfCap             ZStackStatus = 0xed
+	ZMacPANIDConflict        ZStackStatus = 0xee
+	ZMacRealignment          ZStackStatus = 0xef
+	ZMacTransactionExpired   ZStackStatus = 0xf0
+	ZMacTransactionOverflow  ZStackStatus = 0xf1
+	ZMacTxActive             ZStackStatus = 0xf2
+	ZMacUnavailableKey       ZStackStatus = 0xf3
+	ZMacUnsupportedAttrib    ZStackStatus = 0xf4
+	ZMacUnsupported          ZStackStatus = 0xf5
+	ZMacSrcMatchInvalidIndex ZStackStatus = 0xff
+)
+
+var zStackStatusNames = map[ZStackStatus]string{
+	ZSuccess:                 "SUCCESS",
+	ZFailure:                 "FAILURE",
+	ZInvalidParameter:        "INVALID_PARAMETER",
+	ZInvalidTask:             "INVALID_TASK",
+	ZMsgBufferNotAvail:       "MSG_BUFFER_NOT_AVAIL",
+	ZInvalidMsgPointer:       "INVALID_MSG_POINTER",
+	ZInvalidEventID:          "INVALID_EVENT_ID",
+	ZInvalidInterruptID:      "INVALID_INTERRUPT_ID",
+	ZNoTimerAvail:            "NO_TIMER_AVAIL",
+	ZNVItemUninit:            "NV_ITEM_UNINIT",
+	ZNVOperFailed:            "NV_OPER_FAILED",
+	ZInvalidMemSize:          "INVALID_MEM_SIZE",
+	ZNVBadItemLen:            "NV_BAD_ITEM_LEN",
+	ZMemError:                "MEM_ERROR",
+	ZBufferFull:              "BUFFER_FULL",
+	ZUnsupportedMode:         "UNSUPPORTED_MODE",
+	ZMacMemError:             "MAC_MEM_ERROR",
+	ZSapiInProgress:          "SAPI_IN_PROGRESS",
+	ZSapiTimeout:             "SAPI_TIMEOUT",
+	ZSapiInit:                "SAPI_INIT",
+	ZNotAuthorized:           "NOT_AUTHORIZED",
+	ZdpInvalidRequestType:    "ZDP_INVALID_REQTYPE",
+	ZdpDeviceNotFound:        "ZDP_DEVICE_NOT_FOUND",
+	ZdpInvalidEndpoint:       "ZDP_INVALID_EP",
+	ZdpNotActive:             "ZDP_NOT_ACTIVE",
+	ZdpNotSupported:          "ZDP_NOT_SUPPORTED",
+	ZdpTimeout:               "ZDP_TIMEOUT",
+	ZdpNoMatch:               "ZDP_NO_MATCH",
+	ZdpNoEntry:               "ZDP_NO_ENTRY",
+	ZdpNoDescriptor:          "ZDP_NO_DESCRIPTOR",
+	ZdpInsufficientSpace:     "ZDP_INSUFFICIENT_SPACE",
+	ZdpNotPermitted:          "ZDP_NOT_PERMITTED",
+	ZdpTableFull:             "ZDP_TABLE_FULL",
+	ZdpNotAuthorized:         "ZDP_NOT_AUTHORIZED",
+	ZdpBindingTableFull:      "ZDP_BINDING_TABLE_FULL",
+	ZApsFail:                 "APS_FAIL",
+	ZApsTableFull:            "APS_TABLE_FULL",
+	ZApsIllegalRequest:       "APS_ILLEGAL_REQUEST",
+	ZApsInvalidBinding:       "APS_INVALID_BINDING",
+	ZApsUnsupportedAttrib:    "APS_UNSUPPORTED_ATTRIB",
+	ZApsNotSupported:         "APS_NOT_SUPPORTED",
+	ZApsNoAck:                "APS_NO_ACK",
+	ZApsDuplicateEntry:       "APS_DUPLICATE_ENTRY",
+	ZApsNoBoundDevice:        "APS_NO_BOUND_DEVICE",
+	ZApsNotAllowed:           "APS_NOT_ALLOWED",
+	ZApsNotAuthenticated:     "APS_NOT_AUTHENTICATED",
+	ZSecNoKey:                "SEC_NO_KEY",
+	ZSecOldFrameCount:        "SEC_OLD_FRM_COUNT",
+	ZSecMaxFrameCount:        "SEC_MAX_FRM_COUNT",
+	ZSecCCMFail:              "SEC_CCM_FAIL",
+	ZSecFailure:              "SEC_FAILURE",
+	ZNwkInvalidParam:         "NWK_INVALID_PARAM",
+	ZNwkInvalidRequest:       "NWK_INVALID_REQUEST",
+	ZNwkNotPermitted:         "NWK_NOT_PERMITTED",
+	ZNwkStartupFailure:       "NWK_STARTUP_FAILURE",
+	ZNwkAlreadyPresent:       "NWK_ALREADY_PRESENT",
+	ZNwkSyncFailure:          "NWK_SYNC_FAILURE",
+	ZNwkTableFull:            "NWK_TABLE_FULL",
+	ZNwkUnknownDevice:        "NWK_UNKNOWN_DEVICE",
+	ZNwkUnsupportedAttrib:    "NWK_UNSUPPORTED_ATTRIBUTE",
+	ZNwkNoNetworks:           "NWK_NO_NETWORKS",
+	ZNwkLeaveUnconfirmed:     "NWK_LEAVE_UNCONFIRMED",
+	ZNwkNoAck:                "NWK_NO_ACK",
+	ZNwkNoRoute:              "NWK_NO_ROUTE",
+	ZMacBeaconLoss:           "MAC_BEACON_LOSS",
+	ZMacChannelAccessFail:    "MAC_CHANNEL_ACCESS_FAILURE",
+	ZMacDenied:               "MAC_DENIED",
+	ZMacDisableTrxFailure:    "MAC_DISABLE_TRX_FAILURE",
+	ZMacFailedSecurity:       "MAC_FAILED_SECURITY_CHECK",
+	ZMacFrameTooLong:         "MAC_FRAME_TOO_LONG",
+	ZMacInvalidGTS:           "MAC_INVALID_GTS",
+	ZMacInvalidHandle:        "MAC_INVALID_HANDLE",
+	ZMacInvalidParameter:     "MAC_INVALID_PARAMETER",
+	ZMacNoAck:                "MAC_NO_ACK",
+	ZMacNoBeacon:             "MAC_NO_BEACON",
+	ZMacNoData:               "MAC_NO_DATA",
+	ZMacNoShortAddress:       "MAC_NO_SHORT_ADDR",
+	ZMacOutOfCap:             "MAC_OUT_OF_CAP",
+	ZMacPANIDConflict:        "MAC_PAN_ID_CONFLICT",
+	ZMacRealignment:          "MAC_REALIGNMENT",
+	ZMacTransactionExpired:   "MAC_TRANSACTION_EXPIRED",
+	ZMacTransactionOverflow:  "MAC_TRANSACTION_OVERFLOW",
+	ZMacTxActive:             "MAC_TX_ACTIVE",
+	ZMacUnavailableKey:       "MAC_UNAVAILABLE_KEY",
+	ZMacUnsupportedAttrib:    "MAC_UNSUPPORTED_ATTRIBUTE",
+	ZMacUnsupported:          "MAC_UNSUPPORTED",
+	ZMacSrcMatchInvalidIndex: "MAC_SRC_MATCH_INVALID_INDEX",
+}
+
+func (s ZStackStatus) String() string {
+	if name, found := zStackStatusNames[s]; found {
+		return name
+	}
+
+	return fmt.Sprintf("UNKNOWN_STATUS(0x%02x)", uint8(s))
+}
+
+/* Allows a status to be used as an errors.Is target, e.g. errors.Is(err, ZMacNoAck). */
+func (s ZStackStatus) Error() string {
+	return s.String()
+}
+
+type ZStackStatusError struct {
+	Err    error
+	Status ZStackStatus
+}
+
+func (e ZStackStatusError) Error() string {
+	return fmt.Sprintf("%v: status = %v", e.Err, e.Status)
+}
+
+func (e ZStackStatusError) Unwrap() []error {
+	return []error{e.Err, e.Status}
+}
+
+func statusError(err error, v interface{}) error {
+	return ZStackStatusError{Err: err, Status: statusOf(v)}
+}
+
+func statusOf(v interface{}) ZStackStatus {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+
+	if rv.Kind() == reflect.Struct {
+		if field := rv.FieldByName("Status"); field.IsValid() && field.Type() == reflect.TypeOf(ZStackStatus(0)) {
+			return ZStackStatus(field.Uint())
+		}
+	}
+
+	return ZFailure
+}
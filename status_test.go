@@ -0,0 +1,38 @@
+package zstack
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestZStackStatus_String(t *testing.T) {
+	t.Run("known statuses are named", func(t *testing.T) {
+		assert.Equal(t, "SUCCESS", ZSuccess.String())
+		assert.Equal(t, "MAC_NO_ACK", ZMacNoAck.String())
+		assert.Equal(t, "NWK_NO_ROUTE", ZNwkNoRoute.String())
+		assert.Equal(t, "APS_NO_ACK", ZApsNoAck.String())
+		assert.Equal(t, "ZDP_NOT_SUPPORTED", ZdpNotSupported.String())
+	})
+
+	t.Run("unknown statuses include their value", func(t *testing.T) {
+		assert.Equal(t, "UNKNOWN_STATUS(0x7f)", ZStackStatus(0x7f).String())
+	})
+}
+
+func TestZStackStatusError(t *testing.T) {
+	t.Run("wraps both the sentinel error and the status", func(t *testing.T) {
+		err := statusError(ErrorZFailure, &AfDataConfirm{Status: ZApsNoAck})
+
+		assert.ErrorIs(t, err, ErrorZFailure)
+		assert.ErrorIs(t, err, ZApsNoAck)
+		assert.False(t, errors.Is(err, ZMacNoAck))
+		assert.Equal(t, "ZStack has returned a failure: status = APS_NO_ACK", err.Error())
+	})
+
+	t.Run("reports a generic failure if the struct has no status", func(t *testing.T) {
+		var statusErr ZStackStatusError
+		assert.ErrorAs(t, statusError(ErrorZFailure, &struct{}{}), &statusErr)
+		assert.Equal(t, ZFailure, statusErr.Status)
+	})
+}
@@ -0,0 +1,158 @@
+package zstack
+
+import (
+	"context"
+	"errors"
+	"github.com/shimmeringbee/logwrap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const DefaultTransactionQuarantine = 10 * time.Second
+
+const transactionIDSpace = 256
+
+type transactionState uint8
+
+const (
+	transactionFree transactionState = iota
+	transactionOutstanding
+	transactionConfirmed
+	transactionUnacknowledged
+	transactionAbandoned
+)
+
+type quarantinedTransaction struct {
+	id    uint8
+	until time.Time
+}
+
+type transactionPool struct {
+	lock        sync.Mutex
+	free        []uint8
+	quarantined []quarantinedTransaction
+	states      [transactionIDSpace]transactionState
+
+	quarantine     time.Duration
+	maxOutstanding int
+	outstanding    int
+
+	released     chan struct{}
+	lateConfirms atomic.Uint64
+}
+
+func newTransactionPool(maxOutstanding int, quarantine time.Duration) *transactionPool {
+	p := &transactionPool{
+		free:           make([]uint8, 0, transactionIDSpace),
+		quarantine:     quarantine,
+		maxOutstanding: maxOutstanding,
+		released:       make(chan struct{}, 1),
+	}
+
+	for i := range transactionIDSpace {
+		p.free = append(p.free, uint8(i))
+	}
+
+	return p
+}
+
+func (p *transactionPool) acquire(ctx context.Context) (uint8, error) {
+	for {
+		id, wait, ok := p.tryAcquire(time.Now())
+		if ok {
+			return id, nil
+		}
+
+		var expiry <-chan time.Time
+
+		if wait > 0 {
+			expiry = time.After(wait)
+		}
+
+		select {
+		case <-p.released:
+		case <-expiry:
+		case <-ctx.Done():
+			return 0, errors.New("context expired while obtaining a free transaction ID")
+		}
+	}
+}
+
+func (p *transactionPool) tryAcquire(now time.Time) (uint8, time.Duration, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for len(p.quarantined) > 0 && !p.quarantined[0].until.After(now) {
+		p.free = append(p.free, p.quarantined[0].id)
+		p.quarantined = p.quarantined[1:]
+	}
+
+	if p.outstanding < p.maxOutstanding && len(p.free) > 0 {
+		id := p.free[0]
+		p.free = p.free[1:]
+		p.states[id] = transactionOutstanding
+		p.outstanding++
+
+		return id, 0, true
+	}
+
+	if len(p.free) == 0 && len(p.quarantined) > 0 {
+		return 0, p.quarantined[0].until.Sub(now), false
+	}
+
+	return 0, 0, false
+}
+
+/* Releasing with any outcome other than transactionConfirmed quarantines the ID, as a confirm may still be received for it. */
+func (p *transactionPool) release(id uint8, outcome transactionState) {
+	p.lock.Lock()
+
+	p.states[id] = outcome
+	p.outstanding--
+
+	if outcome == transactionConfirmed {
+		p.free = append(p.free, id)
+	} else {
+		p.quarantined = append(p.quarantined, quarantinedTransaction{id: id, until: time.Now().Add(p.quarantine)})
+	}
+
+	p.lock.Unlock()
+
+	select {
+	case p.released <- struct{}{}:
+	default:
+	}
+}
+
+/* Returns true if the confirmation was for a transaction that had been abandoned, i.e. it arrived late. */
+func (p *transactionPool) observeConfirm(id uint8) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	switch p.states[id] {
+	case transactionAbandoned:
+		p.lateConfirms.Add(1)
+		return true
+	case transactionUnacknowledged:
+		p.states[id] = transactionConfirmed
+	}
+
+	return false
+}
+
+func (z *ZStack) LateTransactionConfirms() uint64 {
+	return z.transactionPool.lateConfirms.Load()
+}
+
+func (z *ZStack) startTransactionTracker() func() {
+	_, stop := z.subscriber.Subscribe(&AfDataConfirm{}, func(v interface{}) {
+		msg := v.(*AfDataConfirm)
+
+		if z.transactionPool.observeConfirm(msg.TransactionID) {
+			z.logger.LogWarn(context.Background(), "Received AfDataConfirm for a transaction that is no longer outstanding.", logwrap.Datum("TransactionID", msg.TransactionID), logwrap.Datum("Endpoint", msg.Endpoint), logwrap.Datum("Status", msg.Status.String()), logwrap.Datum("LateConfirms", z.transactionPool.lateConfirms.Load()))
+		}
+	})
+
+	return stop
+}
@@ -0,0 +1,102 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	. "github.com/shimmeringbee/unpi"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_transactionPool(t *testing.T) {
+	t.Run("ids are handed out across the full 8-bit space before reuse", func(t *testing.T) {
+		p := newTransactionPool(transactionIDSpace, time.Minute)
+
+		seen := map[uint8]bool{}
+
+		for range transactionIDSpace {
+			id, err := p.acquire(context.Background())
+			assert.NoError(t, err)
+			seen[id] = true
+			p.release(id, transactionConfirmed)
+		}
+
+		assert.Len(t, seen, transactionIDSpace)
+	})
+
+	t.Run("limits the number of outstanding transactions", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		p := newTransactionPool(1, time.Minute)
+
+		_, err := p.acquire(ctx)
+		assert.NoError(t, err)
+
+		_, err = p.acquire(ctx)
+		assert.Error(t, err)
+	})
+
+	t.Run("abandoned ids are quarantined before being reused", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		p := newTransactionPool(transactionIDSpace, 50*time.Millisecond)
+		p.free = []uint8{0x01}
+
+		id, err := p.acquire(ctx)
+		assert.NoError(t, err)
+		p.release(id, transactionAbandoned)
+
+		start := time.Now()
+
+		id, err = p.acquire(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(0x01), id)
+		assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+	})
+
+	t.Run("confirms for abandoned transactions are counted as late", func(t *testing.T) {
+		p := newTransactionPool(transactionIDSpace, time.Minute)
+
+		abandoned, _ := p.acquire(context.Background())
+		p.release(abandoned, transactionAbandoned)
+
+		unacknowledged, _ := p.acquire(context.Background())
+		p.release(unacknowledged, transactionUnacknowledged)
+
+		outstanding, _ := p.acquire(context.Background())
+
+		assert.True(t, p.observeConfirm(abandoned))
+		assert.False(t, p.observeConfirm(unacknowledged))
+		assert.False(t, p.observeConfirm(outstanding))
+		assert.Equal(t, uint64(1), p.lateConfirms.Load())
+	})
+}
+
+func Test_TransactionTracker(t *testing.T) {
+	t.Run("counts late confirms received from the adapter", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		id, _ := zstack.transactionPool.acquire(context.Background())
+		zstack.transactionPool.release(id, transactionAbandoned)
+
+		stop := zstack.startTransactionTracker()
+		defer stop()
+
+		unpiMock.InjectOutgoing(Frame{
+			MessageType: AREQ,
+			Subsystem:   AF,
+			CommandID:   AfDataConfirmID,
+			Payload:     []byte{0x00, 0x01, id},
+		})
+
+		assert.Eventually(t, func() bool {
+			return zstack.LateTransactionConfirms() == 1
+		}, 100*time.Millisecond, 5*time.Millisecond)
+	})
+}
@@ -2,16 +2,18 @@ package zstack
 
 import (
 	"context"
+	"fmt"
 	"github.com/shimmeringbee/logwrap"
 	"github.com/shimmeringbee/logwrap/impl/golog"
 	"github.com/shimmeringbee/persistence"
 	"github.com/shimmeringbee/unpi/broker"
 	"github.com/shimmeringbee/unpi/library"
 	"github.com/shimmeringbee/zigbee"
-	"golang.org/x/sync/semaphore"
 	"io"
 	"log"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,20 +35,49 @@ type ZStack struct {
 	subscriber       Subscriber
 
 	NetworkProperties NetworkProperties
+	adapterVersion    Version
 
-	events chan interface{}
+	state     AdapterState
+	stateLock sync.RWMutex
+
+	ctx            context.Context
+	cancel         context.CancelFunc
+	background     sync.WaitGroup
+	backgroundLock sync.Mutex
+	stopBroker     func()
+
+	networkKeySwitchDelay time.Duration
+
+	eventBus *eventBus
+	events   *EventSubscription
 
-	networkManagerStop     chan bool
 	networkManagerIncoming chan interface{}
+	networkManagerCancel   context.CancelFunc
+	nodeTableCallbackOnce  sync.Once
 
 	messageReceiverStop func()
 
-	nodeTable          *nodeTable
-	transactionIdStore chan uint8
+	adapterMonitorStop       []func()
+	adapterMonitorRecovering atomic.Bool
+
+	healthCheckStop     chan struct{}
+	healthCheckInterval time.Duration
+	adapterHealth       adapterHealth
+
+	registeredEndpoints     []AFRegister
+	registeredEndpointsLock sync.Mutex
+
+	nodeTable       *nodeTable
+	transactionPool *transactionPool
+	dataStoreSlot   chan struct{}
+	sleepyQueue     *sleepyQueue
+	nodeGuards      *nodeGuards
 
 	persistence persistence.Section
 
-	sem *semaphore.Weighted
+	scheduler *scheduler
+
+	config options
 
 	logger logwrap.Logger
 }
@@ -77,39 +108,115 @@ const DefaultZStackRetries = 3
 const DefaultInflightEvents = 50
 const DefaultInflightTransactions = 20
 
-func New(uart io.ReadWriter, p persistence.Section) *ZStack {
+func New(uart io.ReadWriter, p persistence.Section, opts ...Option) *ZStack {
+	config := defaultOptions()
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
 	ml := library.NewLibrary()
 	registerMessages(ml)
 
 	znp := broker.NewBroker(uart, uart, ml)
 	znp.Start()
 
-	transactionIDs := make(chan uint8, DefaultInflightTransactions)
-
-	for i := range DefaultInflightTransactions {
-		transactionIDs <- uint8(i)
-	}
+	ctx, cancel := context.WithCancel(context.Background())
 
 	zstack := &ZStack{
+		ctx:                    ctx,
+		cancel:                 cancel,
+		stopBroker:             znp.Stop,
 		requestResponder:       znp,
 		awaiter:                znp,
 		subscriber:             znp,
-		events:                 make(chan interface{}, DefaultInflightEvents),
-		networkManagerStop:     make(chan bool, 1),
-		networkManagerIncoming: make(chan interface{}, DefaultInflightEvents),
+		eventBus:               newEventBus(ctx),
+		networkManagerIncoming: make(chan interface{}, config.inflightEvents),
 		nodeTable:              newNodeTable(p.Section("Nodes")),
-		transactionIdStore:     transactionIDs,
+		transactionPool:        newTransactionPool(config.inflightTransactions, config.transactionQuarantine),
+		sleepyQueue:            newSleepyQueue(),
+		nodeGuards:             newNodeGuards(),
+		scheduler:              newScheduler(0),
+		dataStoreSlot:          make(chan struct{}, 1),
 		persistence:            p,
+		networkKeySwitchDelay:  DefaultNetworkKeySwitchDelay,
+		healthCheckInterval:    DefaultHealthCheckInterval,
+		config:                 config,
 	}
 
+	zstack.events = zstack.Subscribe(config.inflightEvents, config.eventOverflowPolicy)
 	zstack.WithGoLogger(log.New(os.Stderr, "", log.LstdFlags))
 
 	return zstack
 }
 
-func (z *ZStack) Stop() {
+func (z *ZStack) Stop(ctx context.Context) error {
+	if previous := z.setState(Stopped); previous == Stopped {
+		return nil
+	}
+
+	z.stopAdapterMonitor()
+	z.stopHealthCheck()
 	z.stopNetworkManager()
 	z.stopMessageReceiver()
+	z.sleepyQueue.stopTimers()
+
+	z.backgroundLock.Lock()
+	z.cancel()
+	z.backgroundLock.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		z.background.Wait()
+		close(done)
+	}()
+
+	var err error
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("context expired while waiting for background work to finish: %w", ctx.Err())
+	}
+
+	z.closeEvents()
+	z.stopBroker()
+
+	return err
+}
+
+func (z *ZStack) startBackground() bool {
+	z.backgroundLock.Lock()
+	defer z.backgroundLock.Unlock()
+
+	if z.ctx.Err() != nil {
+		return false
+	}
+
+	z.background.Add(1)
+	return true
+}
+
+func (z *ZStack) goBackground(f func()) {
+	if !z.startBackground() {
+		return
+	}
+
+	go func() {
+		defer z.background.Done()
+		f()
+	}()
+}
+
+func (z *ZStack) withRootContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(z.ctx, cancel)
+
+	return ctx, func() {
+		stop()
+		cancel()
+	}
 }
 
 func (z *ZStack) WithGoLogger(parentLogger *log.Logger) {
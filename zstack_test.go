@@ -0,0 +1,71 @@
+package zstack
+
+import (
+	"context"
+	"github.com/shimmeringbee/persistence/impl/memory"
+	unpiTest "github.com/shimmeringbee/unpi/testing"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestZStack_Stop(t *testing.T) {
+	t.Run("cancels the root context and waits for background work to finish", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		finished := make(chan struct{})
+
+		zstack.goBackground(func() {
+			<-zstack.ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			close(finished)
+		})
+
+		err := zstack.Stop(context.Background())
+		assert.NoError(t, err)
+
+		select {
+		case <-finished:
+		default:
+			t.Fatal("stop returned before background work finished")
+		}
+
+		assert.Equal(t, Stopped, zstack.State())
+	})
+
+	t.Run("returns an error if background work does not finish before the context expires", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		release := make(chan struct{})
+		defer close(release)
+
+		zstack.goBackground(func() {
+			<-release
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := zstack.Stop(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("background work is not started once stopped", func(t *testing.T) {
+		unpiMock := unpiTest.NewMockAdapter()
+		zstack := New(unpiMock, memory.New())
+		defer unpiMock.Stop()
+
+		err := zstack.Stop(context.Background())
+		assert.NoError(t, err)
+
+		started := false
+		zstack.goBackground(func() { started = true })
+
+		assert.False(t, zstack.startBackground())
+		assert.False(t, started)
+	})
+}